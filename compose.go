@@ -0,0 +1,252 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  yamlv3 "gopkg.in/yaml.v3"
+
+  temp "github.com/concourse/fly/template"
+)
+
+// Top-level lists whose items are named, and what an item is called in
+// DuplicateNameError
+var composedLists = map[string]string{
+  "groups":         "group",
+  "jobs":           "job",
+  "resources":      "resource",
+  "resource_types": "resource type",
+}
+
+// DuplicateName is an item defined more than once across fragments.
+type DuplicateName struct {
+  Kind      string
+  Name      string
+  Locations []ConfigLocation
+}
+
+// DuplicateNameError lists every duplicate found while composing a config.
+type DuplicateNameError struct {
+  Duplicates []DuplicateName
+}
+
+func (err DuplicateNameError) Error() string {
+  lines := []string{"duplicate names in pipeline fragments:"}
+  for _, d := range err.Duplicates {
+    locations := []string{}
+    for _, location := range d.Locations {
+      locations = append(locations, location.String())
+    }
+    lines = append(lines, fmt.Sprintf("  %s '%s' is defined in %s", d.Kind, d.Name, strings.Join(locations, ", ")))
+  }
+  return strings.Join(lines, "\n")
+}
+
+func (err DuplicateNameError) Is(target error) bool {
+  return target == ErrInvalidConfig
+}
+
+// ComposeConfig merges pipeline fragments into a single config, to be
+// evaluated like any other. Each fragment is a partial config such as
+//
+//   jobs:
+//     - name: deploy
+//       plan: [...]
+//
+// and paths may be files or directories, whose .yml and .yaml files are
+// read recursively in lexical order. The lists of every fragment are
+// concatenated in order; other top-level keys may only be set once. ((var))
+// placeholders are left for evaluation, and {{var}} ones are rejected.
+// Aliases may only refer to anchors of their own fragment, and are expanded.
+func ComposeConfig(paths ...string) ([]byte, error) {
+  files := []string{}
+  for _, path := range paths {
+    found, err := fragmentFiles(path)
+    if err != nil {
+      return nil, err
+    }
+    files = append(files, found...)
+  }
+
+  composed := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+  keyFiles := map[string]string{}
+  locations := map[string]map[string][]ConfigLocation{}
+
+  for _, file := range files {
+    contents, err := ioutil.ReadFile(file)
+    if err != nil {
+      return nil, fmt.Errorf("could not read pipeline fragment (%s): %s", file, err.Error())
+    }
+
+    // {{var}} is not YAML, and would not survive being re-encoded
+    if temp.Present(contents) {
+      return nil, fmt.Errorf("%s: cannot compose a fragment with {{var}} placeholders; migrate them to ((var)) first", file)
+    }
+
+    // Aliases to other fragments fail here, as unknown anchors
+    var document yamlv3.Node
+    err = yamlv3.Unmarshal(contents, &document)
+    if err != nil {
+      return nil, fmt.Errorf("could not parse pipeline fragment (%s): %s", file, err.Error())
+    }
+    if len(document.Content) == 0 {
+      continue
+    }
+
+    fragment := expandAliases(document.Content[0])
+    if fragment.Kind != yamlv3.MappingNode {
+      return nil, fmt.Errorf("%s: pipeline fragment must be a map", file)
+    }
+
+    for i := 0; i+1 < len(fragment.Content); i += 2 {
+      keyNode, valueNode := fragment.Content[i], fragment.Content[i+1]
+      key := keyNode.Value
+
+      kind, isList := composedLists[key]
+      if !isList {
+        if previous, found := keyFiles[key]; found {
+          return nil, fmt.Errorf("%s:%d:%d: '%s' is already set in %s", file, keyNode.Line, keyNode.Column, key, previous)
+        }
+        keyFiles[key] = file
+        composed.Content = append(composed.Content, keyNode, valueNode)
+        continue
+      }
+
+      if valueNode.Tag == "!!null" {
+        continue
+      }
+      if valueNode.Kind != yamlv3.SequenceNode {
+        return nil, fmt.Errorf("%s:%d:%d: %s must be a list", file, valueNode.Line, valueNode.Column, key)
+      }
+
+      if locations[kind] == nil {
+        locations[kind] = map[string][]ConfigLocation{}
+      }
+      for _, item := range valueNode.Content {
+        if nameNode := mappingValue(item, "name"); nameNode != nil {
+          locations[kind][nameNode.Value] = append(locations[kind][nameNode.Value], ConfigLocation{
+            Path: file, Line: nameNode.Line, Column: nameNode.Column,
+          })
+        }
+      }
+
+      list := mappingValue(composed, key)
+      if list == nil {
+        list = &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+        composed.Content = append(composed.Content, keyNode, list)
+      }
+      list.Content = append(list.Content, valueNode.Content...)
+    }
+  }
+
+  if duplicates := duplicateNames(locations); len(duplicates) > 0 {
+    return nil, DuplicateNameError{Duplicates: duplicates}
+  }
+
+  if len(composed.Content) == 0 {
+    return []byte{}, nil
+  }
+
+  return encodeYAMLNode(composed)
+}
+
+// encodeYAMLNode encodes a yaml.v3 document with two-space indentation.
+func encodeYAMLNode(document *yamlv3.Node) ([]byte, error) {
+  clearMergeTags(document)
+
+  var buffer bytes.Buffer
+  encoder := yamlv3.NewEncoder(&buffer)
+  encoder.SetIndent(2)
+  if err := encoder.Encode(document); err != nil {
+    return nil, err
+  }
+  encoder.Close()
+
+  return buffer.Bytes(), nil
+}
+
+// clearMergeTags drops the !!merge tag yaml.v3 gives << keys, which it
+// would otherwise print as "!!merge <<".
+func clearMergeTags(node *yamlv3.Node) {
+  if node.Kind == yamlv3.ScalarNode && node.Tag == "!!merge" {
+    node.Tag = ""
+  }
+  for _, child := range node.Content {
+    clearMergeTags(child)
+  }
+}
+
+// expandAliases returns a copy of node with aliases replaced by copies of
+// what they refer to, and anchors dropped. Fragments are reordered when
+// composed, which could put an alias before its anchor, and several fragments
+// may define the same anchor.
+func expandAliases(node *yamlv3.Node) *yamlv3.Node {
+  if node.Kind == yamlv3.AliasNode {
+    return expandAliases(node.Alias)
+  }
+
+  copied := *node
+  copied.Anchor = ""
+  copied.Content = make([]*yamlv3.Node, len(node.Content))
+  for i, child := range node.Content {
+    copied.Content[i] = expandAliases(child)
+  }
+  return &copied
+}
+
+func fragmentFiles(path string) ([]string, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return nil, fmt.Errorf("could not read pipeline fragment (%s): %s", path, err.Error())
+  }
+  if !info.IsDir() {
+    return []string{path}, nil
+  }
+
+  files := []string{}
+  err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if file != path && strings.HasPrefix(info.Name(), ".") {
+      if info.IsDir() {
+        return filepath.SkipDir
+      }
+      return nil
+    }
+    extension := filepath.Ext(file)
+    if !info.IsDir() && (extension == ".yml" || extension == ".yaml") {
+      files = append(files, file)
+    }
+    return nil
+  })
+  if err != nil {
+    return nil, fmt.Errorf("could not read pipeline fragments (%s): %s", path, err.Error())
+  }
+
+  return files, nil
+}
+
+func duplicateNames(locations map[string]map[string][]ConfigLocation) []DuplicateName {
+  duplicates := []DuplicateName{}
+  for kind, names := range locations {
+    for name, nameLocations := range names {
+      if len(nameLocations) > 1 {
+        duplicates = append(duplicates, DuplicateName{Kind: kind, Name: name, Locations: nameLocations})
+      }
+    }
+  }
+
+  sort.Slice(duplicates, func(i, j int) bool {
+    if duplicates[i].Kind != duplicates[j].Kind {
+      return duplicates[i].Kind < duplicates[j].Kind
+    }
+    return duplicates[i].Name < duplicates[j].Name
+  })
+  return duplicates
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+func TestComposeConfig(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "pipeline")
+  defer os.RemoveAll(dir)
+  os.Mkdir(filepath.Join(dir, "jobs"), 0755)
+  os.Mkdir(filepath.Join(dir, "resources"), 0755)
+  writeTempFile(t, dir, "groups.yml", "groups:\n  - name: all\n    jobs: [unit, ((deployJob))]\n")
+  writeTempFile(t, dir, "jobs/1-unit.yml", "jobs:\n  - name: unit\n    plan: [get: repo]\n")
+  writeTempFile(t, dir, "jobs/2-deploy.yml", "jobs:\n  # lint:ignore public-job\n  - name: ((deployJob))\n    public: true\n    plan: [get: repo]\n")
+  writeTempFile(t, dir, "jobs/README.md", "not a fragment")
+  writeTempFile(t, dir, "resources/repo.yml", "resources:\n  - name: repo\n    type: git\n")
+
+  config, err := ComposeConfig(filepath.Join(dir, "groups.yml"), filepath.Join(dir, "jobs"), filepath.Join(dir, "resources"))
+  assert.Nil(t, err)
+  assert.Equal(t, `groups:
+  - name: all
+    jobs: [unit, ((deployJob))]
+jobs:
+  - name: unit
+    plan: [{get: repo}]
+  # lint:ignore public-job
+  - name: ((deployJob))
+    public: true
+    plan: [{get: repo}]
+resources:
+  - name: repo
+    type: git
+`, string(config), "Should concatenate fragment lists in order")
+
+  warnings, err := ValidateConfigWithOptions(config, ValidateOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{StaticVarSource{Vars: map[string]interface{}{"deployJob": "deploy"}}},
+    },
+    Lint: &LintOptions{},
+  })
+  assert.Nil(t, err)
+  assert.Empty(t, warnings, "Should keep lint suppressions")
+}
+
+func TestComposeDuplicateNames(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "pipeline")
+  defer os.RemoveAll(dir)
+  first := writeTempFile(t, dir, "a.yml", "jobs:\n  - name: unit\nresources:\n  - name: repo\n")
+  second := writeTempFile(t, dir, "b.yml", "jobs:\n  - name: deploy\n  - name: unit\n")
+
+  _, err := ComposeConfig(first, second)
+  assert.True(t, errors.Is(err, ErrInvalidConfig))
+  assert.Equal(t, DuplicateNameError{Duplicates: []DuplicateName{
+    {Kind: "job", Name: "unit", Locations: []ConfigLocation{{first, 2, 11}, {second, 3, 11}}},
+  }}, err)
+  assert.Contains(t, err.Error(), "job 'unit' is defined in "+first+":2:11, "+second+":3:11")
+
+  third := writeTempFile(t, dir, "c.yml", "meta: {a: 1}\n")
+  _, err = ComposeConfig(third, third)
+  assert.EqualError(t, err, third+":1:1: 'meta' is already set in "+third)
+}
+
+func TestComposeTemplateStyles(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "pipeline")
+  defer os.RemoveAll(dir)
+  old := writeTempFile(t, dir, "old.yml", "jobs:\n  - name: {{jobName}}\n")
+
+  _, err := ComposeConfig(old)
+  assert.EqualError(t, err, old+": cannot compose a fragment with {{var}} placeholders; migrate them to ((var)) first")
+}
+
+func TestComposeAnchors(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "pipeline")
+  defer os.RemoveAll(dir)
+  jobs := writeTempFile(t, dir, "a.yml", "jobs:\n  - name: unit\n    plan: [get: repo]\n")
+  resources := writeTempFile(t, dir, "b.yml", `git: &git
+  type: git
+  source: {uri: ((uri))}
+resources:
+  - <<: *git
+    name: repo
+jobs:
+  - name: deploy
+    plan: [get: repo]
+`)
+
+  config, err := ComposeConfig(jobs, resources)
+  assert.Nil(t, err)
+  assert.Equal(t, `jobs:
+  - name: unit
+    plan: [{get: repo}]
+  - name: deploy
+    plan: [{get: repo}]
+git:
+  type: git
+  source: {uri: ((uri))}
+resources:
+  - <<:
+      type: git
+      source: {uri: ((uri))}
+    name: repo
+`, string(config), "Should expand aliases within a fragment")
+
+  evaluated, err := EvaluateConfigWithOptions(config, EvaluateOptions{
+    Sources: []VarSource{stringMapSource(map[string]string{"uri": "git@example.com:repo"})},
+  })
+  assert.Nil(t, err)
+  var composed atc.Config
+  assert.Nil(t, yaml.Unmarshal(evaluated, &composed))
+  assert.Equal(t, "git", composed.Resources[0].Type)
+
+  alias := writeTempFile(t, dir, "c.yml", "resources:\n  - <<: *git\n    name: tools\n")
+  _, err = ComposeConfig(resources, alias)
+  assert.EqualError(t, err, "could not parse pipeline fragment ("+alias+"): yaml: unknown anchor 'git' referenced",
+    "Should reject aliases to other fragments")
+}
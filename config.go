@@ -3,7 +3,7 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
+	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -16,10 +16,111 @@ import (
 type BadConfigError struct {
   Warnings []atc.Warning
   Errors []string
+
+  // Issues lists Errors and Warnings one by one, located in the original
+  // config file when possible.
+  Issues []ConfigIssue
 }
 
 func (err BadConfigError) Error() string {
-  return "Bad configuration"
+  if len(err.Issues) == 0 {
+    return "Bad configuration"
+  }
+
+  lines := []string{"Bad configuration:"}
+  for _, issue := range err.Issues {
+    lines = append(lines, issue.String())
+  }
+  return strings.Join(lines, "\n")
+}
+
+func (err BadConfigError) Is(target error) bool {
+  return target == ErrInvalidConfig
+}
+
+// EvaluationError is returned by SetPipeline when a config cannot be
+// evaluated. Err keeps its type, such as UnresolvedVarsError or OpsError.
+type EvaluationError struct {
+  Err error
+}
+
+func (err EvaluationError) Error() string {
+  return "could not evaluate config: " + err.Err.Error()
+}
+
+func (err EvaluationError) Unwrap() error {
+  return err.Err
+}
+
+func (err EvaluationError) Is(target error) bool {
+  return target == ErrInvalidConfig
+}
+
+// EvaluateOptions controls how a pipeline config's template variables are
+// resolved.
+type EvaluateOptions struct {
+	// Sources are applied in order of increasing precedence.
+	Sources []VarSource
+
+	// OpsFiles patch the config, in order, before any of its vars are
+	// resolved, as bosh -o does. Configs with old-style {{var}} placeholders
+	// cannot be patched. Issue locations of ValidateConfigWithOptions refer to
+	// the unpatched config.
+	OpsFiles []OpsFile
+
+	// ExpectAllVars fails the evaluation with an UnresolvedVarsError when a
+	// ((var)) is missing from Sources, instead of leaving it in place. Missing
+	// fields of provided vars, as in ((creds.typo)), always fail.
+	ExpectAllVars bool
+
+	// ServerSideVars are left for the ATC's credential manager to resolve,
+	// even with ExpectAllVars. Entries are path.Match patterns, such as
+	// "vault-*".
+	ServerSideVars []string
+
+	// ShowVarValues includes variable values in the provenance report of
+	// EvaluateConfigWithReport. They are redacted by default.
+	ShowVarValues bool
+
+	// Schema validates the variables before they are substituted, and
+	// provides defaults for the ones no source sets.
+	Schema *VarSchema
+
+	// Sensitive variables are redacted from reports and errors, even with
+	// ShowVarValues. Their values are added to Redactor when it is set, or to
+	// a new one otherwise; either way it is returned in the report.
+	Sensitive SensitiveVars
+	Redactor  *Redactor
+
+	// Set by RenderConfig
+	skipSchemaDefaults bool
+	keepServerSideVars bool
+}
+
+// ValidateOptions controls how ValidateConfigWithOptions evaluates and
+// checks a pipeline config.
+type ValidateOptions struct {
+	EvaluateOptions
+
+	// Strict rejects unknown fields and duplicate keys, and turns warnings
+	// into errors.
+	Strict bool
+
+	// ConfigPath names the config file in issue locations.
+	ConfigPath string
+
+	// Lint runs lint rules on the evaluated config when set. Lint errors fail
+	// the validation, lint warnings are returned with atc's warnings.
+	Lint *LintOptions
+	// Policy is enforced on the evaluated config when set, with the overrides
+	// of Team.
+	Policy *Policy
+	Team   string
+
+	// TaskInputs maps the inputs task files are read from, such as "repo" in
+	// "file: repo/ci/test.yml", to local directories. Task files found there
+	// are validated along with the steps that run them.
+	TaskInputs map[string]string
 }
 
 func ValidateConfig(
@@ -29,31 +130,91 @@ func ValidateConfig(
 	templateVariablesFiles []atc.PathFlag,
 	strict bool,
 ) ([]atc.Warning, error) {
-	newConfig, err := newConfig(configContents, templateVariablesFiles, templateVariables, yamlTemplateVariables, true, strict)
+	return ValidateConfigWithOptions(configContents, ValidateOptions{
+		EvaluateOptions: EvaluateOptions{
+			Sources: FlagVarSources(templateVariables, yamlTemplateVariables, templateVariablesFiles),
+		},
+		Strict: strict,
+	})
+}
+
+func ValidateConfigWithOptions(configContents []byte, options ValidateOptions) ([]atc.Warning, error) {
+	strict := options.Strict
+	report, err := newConfig(configContents, options.EvaluateOptions, true, strict)
 	if err != nil {
 		return nil, err
 	}
 
+	return validateEvaluatedConfig(configContents, report, options)
+}
+
+// validateEvaluatedConfig runs atc's validation, lint rules, task file
+// checks and policy on an evaluated config.
+func validateEvaluatedConfig(configContents []byte, report EvaluationReport, options ValidateOptions) ([]atc.Warning, error) {
+	strict := options.Strict
+	newConfig := report.Config
+	redactor := report.Redactor
+
 	var new atc.Config
 	if strict {
 		// UnmarshalStrict will pick up fields in structs that have the wrong names, as well as any duplicate keys in maps
 		// we should consider always using this everywhere in a later release...
 		if err := yaml.UnmarshalStrict([]byte(newConfig), &new); err != nil {
-			return nil, err
+			return nil, redactor.RedactError(err)
 		}
 	} else {
 		if err := yaml.Unmarshal([]byte(newConfig), &new); err != nil {
-			return nil, err
+			return nil, redactor.RedactError(err)
 		}
 	}
 
 	warnings, errorMessages := new.Validate()
 
+  locator := newConfigLocator(options.ConfigPath, configContents, report.patched, new)
+  issues := locator.issues(warnings, errorMessages)
+
+  if options.Lint != nil {
+    lintIssues, err := options.Lint.run(new, locator)
+    if err != nil {
+      return nil, err
+    }
+
+    for _, issue := range lintIssues {
+      issues = append(issues, issue)
+      if issue.Severity == SeverityError {
+        errorMessages = append(errorMessages, issue.Message)
+      } else {
+        warnings = append(warnings, atc.Warning{Type: "lint", Message: issue.Message})
+      }
+    }
+  }
+
+  if options.TaskInputs != nil {
+    for _, issue := range taskFileIssues(new, options.TaskInputs, locator) {
+      issues = append(issues, issue)
+      if issue.Severity == SeverityError {
+        errorMessages = append(errorMessages, issue.Message)
+      } else {
+        warnings = append(warnings, atc.Warning{Type: "task", Message: issue.Message})
+      }
+    }
+  }
+
+  if options.Policy != nil {
+    for _, issue := range options.Policy.issues(options.Team, new, locator) {
+      issues = append(issues, issue)
+      errorMessages = append(errorMessages, issue.Message)
+    }
+  }
+
+	warnings = redactor.redactWarnings(warnings)
+
 	if len(errorMessages) > 0 || (strict && len(warnings) > 0) {
-    return warnings, BadConfigError{
+    return warnings, redactor.RedactError(BadConfigError{
       Warnings: warnings,
       Errors: errorMessages,
-    }
+      Issues: issues,
+    })
 	}
 
 	return warnings, nil
@@ -63,28 +224,43 @@ func EvaluateConfig(configContents []byte,
     templateVariables []flaghelpers.VariablePairFlag,
     yamlTemplateVariables []flaghelpers.YAMLVariablePairFlag,
     templateVariablesFiles []atc.PathFlag) ([]byte, error) {
-	newConfig, err := newConfig(configContents, templateVariablesFiles, templateVariables, yamlTemplateVariables, false, false)
+	return EvaluateConfigWithOptions(configContents, EvaluateOptions{
+		Sources: FlagVarSources(templateVariables, yamlTemplateVariables, templateVariablesFiles),
+	})
+}
+
+func EvaluateConfigWithOptions(configContents []byte, options EvaluateOptions) ([]byte, error) {
+	report, err := EvaluateConfigWithReport(configContents, options)
 	if err != nil {
 		return nil, err
 	}
 
+	return report.Config, nil
+}
+
+// EvaluateConfigWithReport evaluates a config like EvaluateConfigWithOptions
+// and also reports how its variables were used.
+func EvaluateConfigWithReport(configContents []byte, options EvaluateOptions) (EvaluationReport, error) {
+	report, err := newConfig(configContents, options, false, false)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
+
 	var new atc.Config
-	err = yaml.Unmarshal([]byte(newConfig), &new)
+	err = yaml.Unmarshal([]byte(report.Config), &new)
 	if err != nil {
-		return nil, err
+		return EvaluationReport{}, report.Redactor.RedactError(err)
 	}
 
-	return newConfig, nil
+	return report, nil
 }
 
 func newConfig(
 	evaluatedConfig []byte,
-	templateVariablesFiles []atc.PathFlag,
-	templateVariables []flaghelpers.VariablePairFlag,
-	yamlTemplateVariables []flaghelpers.YAMLVariablePairFlag,
+	options EvaluateOptions,
 	allowEmpty bool,
 	strict bool,
-) ([]byte, error) {
+) (EvaluationReport, error) {
 	if strict {
 		// We use a generic map here, since templates are not evaluated yet.
 		// (else a template string may cause an error when a struct is expected)
@@ -93,60 +269,104 @@ func newConfig(
 		// We should consider being strict throughout the entire stack by default.
 		err := yaml.UnmarshalStrict(evaluatedConfig, make(map[string]interface{}))
 		if err != nil {
-			return nil, fmt.Errorf("error parsing yaml before applying templates: %s", err.Error())
+			return EvaluationReport{}, fmt.Errorf("error parsing yaml before applying templates: %s", err.Error())
 		}
 	}
 
-	var paramPayloads [][]byte
-	for _, path := range templateVariablesFiles {
-		templateVars, err := ioutil.ReadFile(string(path))
+	sources, err := loadVarSources(options.Sources)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
+
+	// Schema violations quote values, so sensitive ones are known first
+	redactor, err := sensitiveRedactor(sources, options.Sensitive, options.Redactor)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
+
+	if options.Schema != nil {
+		withDefaults, err := options.Schema.apply(sources)
 		if err != nil {
-			return nil, fmt.Errorf("could not read template variables file (%s): %s", string(path), err.Error())
+			return EvaluationReport{}, redactor.RedactError(err)
 		}
+		if !options.skipSchemaDefaults {
+			sources = withDefaults
+		}
+	}
+
+	if options.keepServerSideVars {
+		sources, err = withoutVars(sources, options.ServerSideVars)
+		if err != nil {
+			return EvaluationReport{}, err
+		}
+	}
+
+	redactor, err = sensitiveRedactor(sources, options.Sensitive, redactor)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
 
-		paramPayloads = append(paramPayloads, templateVars)
+	// Ops patch the config as written, like bosh -o, before any interpolation
+	evaluatedConfig, err = applyOpsFiles(evaluatedConfig, options.OpsFiles)
+	if err != nil {
+		return EvaluationReport{}, redactor.RedactError(err)
+	}
+	var patched []byte
+	if len(options.OpsFiles) > 0 {
+		patched = evaluatedConfig
 	}
 
+	referenced := deprecatedVarNames(evaluatedConfig)
+
 	if temp.Present(evaluatedConfig) {
-		resolved, err := resolveDeprecatedTemplateStyle(evaluatedConfig, paramPayloads, templateVariables, yamlTemplateVariables, allowEmpty)
+		resolved, err := resolveDeprecatedTemplateStyle(evaluatedConfig, sources, allowEmpty)
 		if err != nil {
-			return nil, fmt.Errorf("could not resolve old-style template vars: %s", err.Error())
+			return EvaluationReport{}, fmt.Errorf("could not resolve old-style template vars: %s", redactor.Redact(err.Error()))
 		}
 
     evaluatedConfig = resolved
 	}
 
-	evaluatedConfig, err := resolveTemplates(evaluatedConfig, paramPayloads, templateVariables, yamlTemplateVariables)
+	refs, err := findVarRefs(evaluatedConfig)
 	if err != nil {
-		return nil, fmt.Errorf("could not resolve template vars: %s", err.Error())
+		return EvaluationReport{}, fmt.Errorf("could not resolve template vars: %s", err.Error())
+	}
+	for _, ref := range refs {
+		referenced[ref.rootName()] = true
 	}
 
-	return evaluatedConfig, nil
-}
-
-func resolveTemplates(configPayload []byte, paramPayloads [][]byte, variables []flaghelpers.VariablePairFlag, yamlVariables []flaghelpers.YAMLVariablePairFlag) ([]byte, error) {
-	tpl := template.NewTemplate(configPayload)
+	err = checkUnresolvedVars(refs, sources, options.ServerSideVars, options.ExpectAllVars)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
 
-	flagVars := template.StaticVariables{}
-	for _, f := range variables {
-		flagVars[f.Name] = f.Value
+	evaluatedConfig, err = resolveTemplates(evaluatedConfig, sources)
+	if err != nil {
+		return EvaluationReport{}, fmt.Errorf("could not resolve template vars: %s", redactor.Redact(err.Error()))
 	}
 
-	for _, f := range yamlVariables {
-		flagVars[f.Name] = f.Value
+	provenance, err := varProvenance(sources, referenced, options.ShowVarValues, options.Sensitive)
+	if err != nil {
+		return EvaluationReport{}, err
 	}
 
-	vars := []template.Variables{flagVars}
-	for i := len(paramPayloads) - 1; i >= 0; i-- {
-		payload := paramPayloads[i]
+	return EvaluationReport{
+		Config:     evaluatedConfig,
+		UnusedVars: unusedVars(sources, referenced),
+		Provenance: provenance,
+		Redactor:   redactor,
+		sources:    sources,
+		patched:    patched,
+	}, nil
+}
 
-		var staticVars template.StaticVariables
-		err := yaml.Unmarshal(payload, &staticVars)
-		if err != nil {
-			return nil, err
-		}
+func resolveTemplates(configPayload []byte, sources []loadedVarSource) ([]byte, error) {
+	tpl := template.NewTemplate(configPayload)
 
-		vars = append(vars, staticVars)
+	// MultiVars returns the first match, so the last source goes first
+	vars := []template.Variables{}
+	for i := len(sources) - 1; i >= 0; i-- {
+		vars = append(vars, template.StaticVariables(sources[i].vars))
 	}
 
 	bytes, err := tpl.Evaluate(template.NewMultiVars(vars), nil, template.EvaluateOpts{})
@@ -159,28 +379,23 @@ func resolveTemplates(configPayload []byte, paramPayloads [][]byte, variables []
 
 func resolveDeprecatedTemplateStyle(
 	configPayload []byte,
-	paramPayloads [][]byte,
-	variables []flaghelpers.VariablePairFlag,
-	yamlVariables []flaghelpers.YAMLVariablePairFlag,
+	sources []loadedVarSource,
 	allowEmpty bool,
 ) ([]byte, error) {
 	vars := temp.Variables{}
-	for _, payload := range paramPayloads {
-		var payloadVars temp.Variables
-		err := yaml.Unmarshal(payload, &payloadVars)
-		if err != nil {
-			return nil, err
+	for _, source := range sources {
+		sourceVars := temp.Variables{}
+		for name, value := range source.vars {
+			// Old-style templates can only hold scalars
+			switch value.(type) {
+			case map[interface{}]interface{}, map[string]interface{}, []interface{}, nil:
+				continue
+			}
+			sourceVars[name] = fmt.Sprintf("%v", value)
 		}
 
-		vars = vars.Merge(payloadVars)
-	}
-
-	flagVars := temp.Variables{}
-	for _, flag := range variables {
-		flagVars[flag.Name] = flag.Value
+		vars = vars.Merge(sourceVars)
 	}
 
-	vars = vars.Merge(flagVars)
-
 	return temp.Evaluate(configPayload, vars, allowEmpty)
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+  "fmt"
+  "reflect"
+  "sort"
+  "strings"
+
+  "github.com/concourse/atc"
+)
+
+type ConfigAction string
+
+const (
+  ConfigAdded   ConfigAction = "added"
+  ConfigRemoved ConfigAction = "removed"
+  ConfigChanged ConfigAction = "changed"
+)
+
+// ConfigChange is a group, job, resource or resource type that a new config
+// adds, removes or changes.
+type ConfigChange struct {
+  // Kind is "group", "job", "resource" or "resource type"
+  Kind   string
+  Name   string
+  Action ConfigAction
+}
+
+// ConfigDiff summarizes the changes between two configs, sorted by kind and
+// name. Names are redacted, as they may come from sensitive vars.
+type ConfigDiff struct {
+  Changes []ConfigChange
+}
+
+func (d ConfigDiff) String() string {
+  if len(d.Changes) == 0 {
+    return "no changes"
+  }
+
+  lines := []string{}
+  for _, change := range d.Changes {
+    lines = append(lines, fmt.Sprintf("%s '%s' %s", change.Kind, change.Name, change.Action))
+  }
+  return strings.Join(lines, "\n")
+}
+
+// diffConfigs compares configs like sameConfig does, item by item.
+func diffConfigs(existing atc.Config, config atc.Config, redactor *Redactor) (ConfigDiff, error) {
+  existingValue, err := normalizedConfig(existing)
+  if err != nil {
+    return ConfigDiff{}, err
+  }
+  value, err := normalizedConfig(config)
+  if err != nil {
+    return ConfigDiff{}, err
+  }
+
+  diff := ConfigDiff{Changes: []ConfigChange{}}
+  add := func(kind string, name string, action ConfigAction) {
+    diff.Changes = append(diff.Changes, ConfigChange{Kind: kind, Name: redactor.Redact(name), Action: action})
+  }
+
+  for list, kind := range composedLists {
+    before := namedItems(existingValue, list)
+    after := namedItems(value, list)
+
+    for name, item := range after {
+      previous, found := before[name]
+      switch {
+      case !found:
+        add(kind, name, ConfigAdded)
+      case !reflect.DeepEqual(previous, item):
+        add(kind, name, ConfigChanged)
+      }
+    }
+    for name := range before {
+      if _, found := after[name]; !found {
+        add(kind, name, ConfigRemoved)
+      }
+    }
+  }
+
+  sort.Slice(diff.Changes, func(i, j int) bool {
+    if diff.Changes[i].Kind != diff.Changes[j].Kind {
+      return diff.Changes[i].Kind < diff.Changes[j].Kind
+    }
+    return diff.Changes[i].Name < diff.Changes[j].Name
+  })
+  return diff, nil
+}
+
+// namedItems returns the items of a top-level list of a normalized config
+// by name.
+func namedItems(config interface{}, list string) map[string]interface{} {
+  items := map[string]interface{}{}
+  root, _ := config.(map[interface{}]interface{})
+  values, _ := root[list].([]interface{})
+  for _, item := range values {
+    fields, _ := item.(map[interface{}]interface{})
+    items[fmt.Sprintf("%v", fields["name"])] = item
+  }
+  return items
+}
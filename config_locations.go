@@ -0,0 +1,364 @@
+package main
+
+import (
+  "reflect"
+  "regexp"
+  "strconv"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+  yamlv3 "gopkg.in/yaml.v3"
+
+  "github.com/concourse/atc"
+)
+
+type Severity string
+
+const (
+  SeverityError   Severity = "error"
+  SeverityWarning Severity = "warning"
+)
+
+// ConfigLocation points into the original, pre-template config file. Line
+// and Column are 1-based, and 0 when unknown.
+type ConfigLocation struct {
+  Path   string
+  Line   int
+  Column int
+}
+
+func (l ConfigLocation) String() string {
+  parts := []string{}
+  if l.Path != "" {
+    parts = append(parts, l.Path)
+  }
+  if l.Line > 0 {
+    parts = append(parts, strconv.Itoa(l.Line))
+    if l.Column > 0 {
+      parts = append(parts, strconv.Itoa(l.Column))
+    }
+  }
+  return strings.Join(parts, ":")
+}
+
+// ConfigIssue is a single error or warning found in a config.
+type ConfigIssue struct {
+  Severity Severity
+  Message  string
+  Location ConfigLocation
+
+  // Rule names the lint rule that reported the issue, if any.
+  Rule string
+}
+
+// String renders the issue compiler-style, as "file:line:col: message",
+// followed by the lint rule in brackets.
+func (i ConfigIssue) String() string {
+  message := i.Message
+  if i.Severity == SeverityWarning {
+    message = "warning: " + message
+  }
+  if i.Rule != "" {
+    message += " [" + i.Rule + "]"
+  }
+
+  location := i.Location.String()
+  if location == "" {
+    return message
+  }
+  return location + ": " + message
+}
+
+var (
+  identifierRegex      = regexp.MustCompile(`^(jobs|resources|resource_types)((?:\.[^.\[\s]+|\[\d+\])*)`)
+  identifierTokenRegex = regexp.MustCompile(`\.([^.\[\s]+)|\[(\d+)\]`)
+  namedThingRegex      = regexp.MustCompile(`^(group|job|resource type|resource) '([^']+)'`)
+)
+
+// Plan identifiers name hooks after their field, minus the "on_" prefix
+var hookKeys = map[string]string{
+  "abort":    "on_abort",
+  "failure":  "on_failure",
+  "success":  "on_success",
+  "ensure":   "ensure",
+  "try":      "try",
+  "timeout":  "timeout",
+  "attempts": "attempts",
+}
+
+// configLocator maps the identifiers atc.Config.Validate() uses, such as
+// "jobs.deploy.plan[2].task.migrate", onto the original config file.
+// Identifiers use names from the evaluated config, so names are first turned
+// into indexes, which templating does not change. Ops files can, so items
+// are then matched between the patched config and the original, and items
+// the ops added or changed are not located.
+type configLocator struct {
+  path  string
+  root  *yamlv3.Node
+  lines []string
+  names map[string][]string
+  // indexes maps the items of patched top-level lists to the original's,
+  // or to -1; it is nil without ops files
+  indexes map[string][]int
+}
+
+// newConfigLocator locates issues of evaluated in original. patched is the
+// config after ops files were applied, before templating, or nil.
+func newConfigLocator(path string, original []byte, patched []byte, evaluated atc.Config) *configLocator {
+  locator := &configLocator{
+    path:  path,
+    lines: strings.Split(string(original), "\n"),
+    names: map[string][]string{},
+  }
+  if patched != nil {
+    locator.indexes = matchItems(original, patched)
+  }
+
+  var document yamlv3.Node
+  if err := yamlv3.Unmarshal(original, &document); err == nil && len(document.Content) > 0 {
+    locator.root = document.Content[0]
+  }
+
+  for _, job := range evaluated.Jobs {
+    locator.names["jobs"] = append(locator.names["jobs"], job.Name)
+  }
+  for _, resource := range evaluated.Resources {
+    locator.names["resources"] = append(locator.names["resources"], resource.Name)
+  }
+  for _, resourceType := range evaluated.ResourceTypes {
+    locator.names["resource_types"] = append(locator.names["resource_types"], resourceType.Name)
+  }
+  for _, group := range evaluated.Groups {
+    locator.names["groups"] = append(locator.names["groups"], group.Name)
+  }
+
+  return locator
+}
+
+// issues splits the grouped messages returned by atc.Config.Validate() into
+// one located issue per line.
+func (l *configLocator) issues(warnings []atc.Warning, errorMessages []string) []ConfigIssue {
+  issues := []ConfigIssue{}
+  for _, errorMessage := range errorMessages {
+    for _, line := range strings.Split(errorMessage, "\n") {
+      // Skip formatErr's "invalid jobs:" headers
+      if !strings.HasPrefix(line, "\t") {
+        continue
+      }
+
+      message := strings.TrimSpace(line)
+      if message == "" {
+        continue
+      }
+
+      issues = append(issues, ConfigIssue{
+        Severity: SeverityError,
+        Message:  message,
+        Location: l.locate(message),
+      })
+    }
+  }
+
+  for _, warning := range warnings {
+    issues = append(issues, ConfigIssue{
+      Severity: SeverityWarning,
+      Message:  warning.Message,
+      Location: l.locate(warning.Message),
+    })
+  }
+
+  return issues
+}
+
+func (l *configLocator) locate(message string) ConfigLocation {
+  location := ConfigLocation{Path: l.path}
+
+  node := l.find(message)
+  if node != nil {
+    location.Line = node.Line
+    location.Column = node.Column
+  }
+
+  return location
+}
+
+func (l *configLocator) find(message string) *yamlv3.Node {
+  if l.root == nil {
+    return nil
+  }
+
+  if match := identifierRegex.FindStringSubmatch(message); match != nil {
+    return l.findIdentifier(match[1], match[2])
+  }
+
+  if match := namedThingRegex.FindStringSubmatch(message); match != nil {
+    list := map[string]string{
+      "group":         "groups",
+      "job":           "jobs",
+      "resource":      "resources",
+      "resource type": "resource_types",
+    }[match[1]]
+    return l.findNamed(list, match[2])
+  }
+
+  return nil
+}
+
+func (l *configLocator) findNamed(list string, name string) *yamlv3.Node {
+  for i, candidate := range l.names[list] {
+    if candidate == name {
+      index, ok := l.originalIndex(list, i)
+      if !ok {
+        return nil
+      }
+      return l.itemKey(l.root, list, index)
+    }
+  }
+  return mappingKey(l.root, list)
+}
+
+// originalIndex returns the index in the original config of the i-th item
+// of a top-level list, and false if ops files added or changed the item.
+func (l *configLocator) originalIndex(list string, i int) (int, bool) {
+  if l.indexes == nil || i < 0 {
+    return i, true
+  }
+  if i >= len(l.indexes[list]) || l.indexes[list][i] < 0 {
+    return -1, false
+  }
+  return l.indexes[list][i], true
+}
+
+// matchItems maps every item of patched's top-level lists to an equal,
+// unmatched item of original's, or to -1.
+func matchItems(original []byte, patched []byte) map[string][]int {
+  var originalConfig, patchedConfig map[string]interface{}
+  yaml.Unmarshal(original, &originalConfig)
+  yaml.Unmarshal(patched, &patchedConfig)
+
+  indexes := map[string][]int{}
+  for _, list := range []string{"jobs", "resources", "resource_types", "groups"} {
+    originalItems, _ := originalConfig[list].([]interface{})
+    patchedItems, _ := patchedConfig[list].([]interface{})
+
+    matched := make([]bool, len(originalItems))
+    for _, item := range patchedItems {
+      index := -1
+      for j, candidate := range originalItems {
+        if !matched[j] && reflect.DeepEqual(item, candidate) {
+          index = j
+          matched[j] = true
+          break
+        }
+      }
+      indexes[list] = append(indexes[list], index)
+    }
+  }
+  return indexes
+}
+
+// itemKey returns the first key of the i-th item of a top-level list, which
+// is where editors place the item.
+func (l *configLocator) itemKey(root *yamlv3.Node, list string, i int) *yamlv3.Node {
+  item := sequenceItem(mappingValue(root, list), i)
+  if item == nil {
+    return mappingKey(root, list)
+  }
+  if item.Kind == yamlv3.MappingNode && len(item.Content) > 0 {
+    return item.Content[0]
+  }
+  return item
+}
+
+// findIdentifier walks as far down the identifier as the original config
+// allows, and returns the deepest node found.
+func (l *configLocator) findIdentifier(list string, rest string) *yamlv3.Node {
+  tokens := identifierTokenRegex.FindAllStringSubmatch(rest, -1)
+  if len(tokens) == 0 {
+    return mappingKey(l.root, list)
+  }
+
+  var index int
+  if tokens[0][2] != "" {
+    index, _ = strconv.Atoi(tokens[0][2])
+  } else {
+    index = -1
+    for i, name := range l.names[list] {
+      if name == tokens[0][1] {
+        index = i
+        break
+      }
+    }
+  }
+
+  index, ok := l.originalIndex(list, index)
+  if !ok {
+    return nil
+  }
+
+  found := mappingKey(l.root, list)
+  current := sequenceItem(mappingValue(l.root, list), index)
+  if current == nil {
+    return found
+  }
+  found = l.itemKey(l.root, list, index)
+
+  for i := 1; i < len(tokens); i++ {
+    key, indexToken := tokens[i][1], tokens[i][2]
+
+    var next, nextFound *yamlv3.Node
+    switch {
+    case indexToken != "":
+      index, _ := strconv.Atoi(indexToken)
+      sequence := current
+      if current.Kind == yamlv3.MappingNode {
+        // Steps inside a do: step are numbered directly after the step
+        sequence = mappingValue(current, "do")
+      }
+      next = sequenceItem(sequence, index)
+      nextFound = next
+      if next != nil && next.Kind == yamlv3.MappingNode && len(next.Content) > 0 {
+        nextFound = next.Content[0]
+      }
+
+    case key == "get" || key == "put" || key == "task":
+      // The step's name follows; point at the step's action
+      i++
+      next = current
+      nextFound = mappingKey(current, key)
+
+    default:
+      if hookKey, ok := hookKeys[key]; ok {
+        key = hookKey
+      }
+      next = mappingValue(current, key)
+      nextFound = mappingKey(current, key)
+    }
+
+    if next == nil || nextFound == nil {
+      break
+    }
+    current, found = next, nextFound
+  }
+
+  return found
+}
+
+func mappingKey(node *yamlv3.Node, key string) *yamlv3.Node {
+  if node == nil || node.Kind != yamlv3.MappingNode {
+    return nil
+  }
+  for i := 0; i+1 < len(node.Content); i += 2 {
+    if node.Content[i].Value == key {
+      return node.Content[i]
+    }
+  }
+  return nil
+}
+
+func sequenceItem(node *yamlv3.Node, i int) *yamlv3.Node {
+  if node == nil || node.Kind != yamlv3.SequenceNode || i < 0 || i >= len(node.Content) {
+    return nil
+  }
+  return node.Content[i]
+}
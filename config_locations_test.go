@@ -0,0 +1,43 @@
+package main
+
+import (
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestLocateValidationErrors(t *testing.T) {
+  _, err := ValidateConfigWithOptions([]byte(`groups:
+  - name: all
+    jobs: [((jobName)), missing]
+jobs:
+  - name: ((jobName))
+    plan:
+      - get: repo
+      - do:
+        - task: build
+resources:
+  - name: repo
+    type: git
+`), ValidateOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{
+        StaticVarSource{Vars: map[string]interface{}{"jobName": "unit"}},
+      },
+    },
+    ConfigPath: "ci/pipeline.yml",
+  })
+  assert.IsType(t, BadConfigError{}, err)
+  assert.Equal(t, []ConfigIssue{
+    {
+      Severity: SeverityError,
+      Message: "group 'all' has unknown job 'missing'",
+      Location: ConfigLocation{"ci/pipeline.yml", 2, 5},
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.unit.plan[1][0].task.build does not specify any task configuration",
+      Location: ConfigLocation{"ci/pipeline.yml", 9, 11},
+    },
+  }, err.(BadConfigError).Issues, "Should locate issues in the original config")
+  assert.Contains(t, err.Error(), "ci/pipeline.yml:9:11: jobs.unit.plan[1][0].task.build does not specify")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+  "io/ioutil"
+  "os"
   "testing"
   "github.com/stretchr/testify/assert"
   "github.com/ribaptista/concourse-poc/flaghelpers"
@@ -79,3 +81,96 @@ func TestParseOldStyleVars(t *testing.T) {
   assert.Nil(t, err, "Should set empty pipeline")
   assert.Equal(t, config.Jobs[0].Name, "importantJob", "Should parse old style vars")
 }
+
+func TestReportUnresolvedVars(t *testing.T) {
+  _, err := EvaluateConfigWithOptions([]byte(`jobs:
+  - name: ((jobName))
+    plan:
+      - task: ((tsak))
+        params:
+          TOKEN: ((vault-token))
+          OTHER: ((typo.field))
+          USER: ((creds.user))
+          PASSWORD: ((creds.pasword))`), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{
+        "jobName": "importantJob",
+        "creds": map[interface{}]interface{}{"user": "admin", "password": "secret"},
+      }},
+    },
+    ExpectAllVars: true,
+    ServerSideVars: []string{"vault-*"},
+  })
+  assert.IsType(t, UnresolvedVarsError{}, err, "Should report unresolved vars")
+  assert.Equal(t, []UnresolvedVar{
+    {Name: "typo.field", Path: "jobs[0].plan[0].params.OTHER"},
+    {Name: "creds.pasword", Path: "jobs[0].plan[0].params.PASSWORD"},
+    {Name: "tsak", Path: "jobs[0].plan[0].task"},
+  }, err.(UnresolvedVarsError).Vars, "Should list every unresolved var with its path")
+
+  _, err = EvaluateConfigWithOptions([]byte(`jobs: [ {name: ((jobName)), public: ((creds.public))} ]`), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{"creds": map[interface{}]interface{}{"user": "admin"}}},
+    },
+  })
+  assert.Equal(t, UnresolvedVarsError{Vars: []UnresolvedVar{
+    {Name: "creds.public", Path: "jobs[0].public"},
+  }}, err, "Should report missing fields of provided vars, which cannot be left for the server")
+}
+
+func TestReportUnusedVars(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "vars")
+  defer os.RemoveAll(dir)
+  varFile := writeTempFile(t, dir, "vars.yml", "jobName: fromFile\nstale-password: hunter2\n")
+
+  report, err := EvaluateConfigWithReport([]byte(`jobs:
+  - name: ((jobName))
+    plan: [{task: {{taskName}}}]`), EvaluateOptions{
+    Sources: FlagVarSources(
+      []flaghelpers.VariablePairFlag{{Name: "taskName", Value: "build"}},
+      []flaghelpers.YAMLVariablePairFlag{{Name: "unused", Value: []interface{}{1, 2}}},
+      []atc.PathFlag{atc.PathFlag(varFile)}),
+  })
+  assert.Nil(t, err)
+  assert.Equal(t, []UnusedVar{
+    {Name: "stale-password", Source: varFile},
+    {Name: "unused", Source: "-y flags"},
+  }, report.UnusedVars, "Should report unused vars with their source")
+}
+
+func TestReportVarProvenance(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "vars")
+  defer os.RemoveAll(dir)
+  commonFile := writeTempFile(t, dir, "common.yml", "jobName: fromCommon\npassword: hunter2\n")
+  envFile := writeTempFile(t, dir, "env.yml", "jobName: fromEnv\n")
+  config := []byte(`jobs:
+  - name: ((jobName))
+    plan: [{task: t, params: {PASSWORD: ((password))}}]`)
+  options := EvaluateOptions{
+    Sources: FlagVarSources(
+      []flaghelpers.VariablePairFlag{{Name: "jobName", Value: "fromFlag"}},
+      []flaghelpers.YAMLVariablePairFlag{},
+      []atc.PathFlag{atc.PathFlag(commonFile), atc.PathFlag(envFile)}),
+  }
+
+  report, err := EvaluateConfigWithReport(config, options)
+  assert.Nil(t, err)
+  assert.Equal(t, []VarProvenance{
+    {
+      Name: "jobName",
+      Source: "-v flags",
+      Value: redacted,
+      Shadowed: []ShadowedVar{
+        {Source: envFile, Value: redacted},
+        {Source: commonFile, Value: redacted},
+      },
+    },
+    {Name: "password", Source: commonFile, Value: redacted, Shadowed: []ShadowedVar{}},
+  }, report.Provenance, "Should report winning and shadowed sources")
+
+  options.ShowVarValues = true
+  report, err = EvaluateConfigWithReport(config, options)
+  assert.Nil(t, err)
+  assert.Equal(t, "fromFlag", report.Provenance[0].Value, "Should show values on request")
+  assert.Equal(t, "fromEnv", report.Provenance[0].Shadowed[0].Value)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "net/http"
+  "reflect"
+
+  "github.com/concourse/go-concourse/concourse"
+  "github.com/concourse/fly/rc"
+  "golang.org/x/oauth2"
+)
+
+// Error kinds for failed calls to the ATC. Check them with errors.Is; the
+// full APIError, with the request id and status code, is available through
+// errors.As. Version mismatches are reported as ErrVersionMismatch, and local
+// evaluation and validation failures as EvaluationError and BadConfigError,
+// which also match ErrInvalidConfig.
+var (
+  ErrUnauthorized  = errors.New("unauthorized")
+  ErrForbidden     = errors.New("forbidden")
+  ErrNotFound      = errors.New("not found")
+  ErrConflict      = errors.New("conflict")
+  ErrServerError   = errors.New("server error")
+  ErrInvalidConfig = errors.New("invalid config")
+)
+
+// APIError is returned when a call to the ATC fails. RequestID is the
+// X-Request-Id the failing request was sent with. Kind is one of the Err*
+// kinds above, or nil if the failure could not be classified.
+type APIError struct {
+  Kind       error
+  StatusCode int
+  RequestID  string
+  Err        error
+}
+
+func (e APIError) Error() string {
+  if e.RequestID == "" {
+    return e.Err.Error()
+  }
+  return fmt.Sprintf("%s (request id: %s)", e.Err.Error(), e.RequestID)
+}
+
+func (e APIError) Unwrap() error {
+  return e.Err
+}
+
+func (e APIError) Is(target error) bool {
+  return e.Kind != nil && e.Kind == target
+}
+
+type requestReporter interface {
+  LastRequestID() string
+  LastStatusCode() int
+}
+
+func newAPIError(target rc.Target, err error) error {
+  reporter, _ := target.(requestReporter)
+  return wrapAPIError(reporter, err)
+}
+
+func wrapAPIError(reporter requestReporter, err error) error {
+  var apiErr APIError
+  if errors.As(err, &apiErr) {
+    return err
+  }
+
+  apiErr = APIError{
+    StatusCode: statusCode(err),
+    Err:        err,
+  }
+
+  if reporter != nil {
+    apiErr.RequestID = reporter.LastRequestID()
+    if apiErr.StatusCode == 0 {
+      apiErr.StatusCode = reporter.LastStatusCode()
+    }
+  }
+
+  apiErr.Kind = errorKind(err, apiErr.StatusCode)
+  return apiErr
+}
+
+func errorKind(err error, statusCode int) error {
+  var configErr concourse.PipelineConfigError
+  if errors.As(err, &configErr) {
+    return ErrInvalidConfig
+  }
+
+  switch {
+  case statusCode == http.StatusBadRequest:
+    return ErrInvalidConfig
+  case statusCode == http.StatusUnauthorized:
+    return ErrUnauthorized
+  case statusCode == http.StatusForbidden:
+    return ErrForbidden
+  case statusCode == http.StatusNotFound:
+    return ErrNotFound
+  case statusCode == http.StatusConflict:
+    return ErrConflict
+  case statusCode >= 500:
+    return ErrServerError
+  }
+
+  return nil
+}
+
+// go-concourse returns some errors of unexported or internal types, which
+// cannot be named here, so they are matched by package path and type name.
+const (
+  goConcoursePackage  = "github.com/concourse/go-concourse/concourse"
+  goConcourseInternal = goConcoursePackage + "/internal"
+)
+
+// statusCode returns the HTTP status of the response an error was made
+// from, for the error types of go-concourse and oauth2, or 0 for others.
+func statusCode(err error) int {
+  var retrieveErr *oauth2.RetrieveError
+  if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+    return retrieveErr.Response.StatusCode
+  }
+
+  for ; err != nil; err = errors.Unwrap(err) {
+    switch err {
+    case concourse.ErrUnauthorized:
+      return http.StatusUnauthorized
+    case concourse.ErrForbidden, concourse.ErrDestroyRefused:
+      return http.StatusForbidden
+    }
+
+    value := reflect.ValueOf(err)
+    switch value.Type().PkgPath() + "." + value.Type().Name() {
+    case goConcoursePackage + ".configValidationError":
+      return http.StatusBadRequest
+    case goConcourseInternal + ".ResourceNotFoundError":
+      return http.StatusNotFound
+    case goConcourseInternal + ".UnexpectedResponseError":
+      return int(value.FieldByName("StatusCode").Int())
+    }
+  }
+
+  return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/concourse/go-concourse/concourse"
+  "github.com/concourse/fly/rc"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/ribaptista/concourse-poc/mocks"
+  "github.com/ribaptista/concourse-poc/flaghelpers"
+  "golang.org/x/oauth2"
+)
+
+// concourseError makes a call with a real go-concourse client against a
+// server that answers with status and body.
+func concourseError(status int, body string, call func(concourse.Team) error) error {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write([]byte(body))
+  }))
+  defer server.Close()
+
+  return call(concourse.NewClient(server.URL, http.DefaultClient, false).Team("main"))
+}
+
+func getConfig(team concourse.Team) error {
+  _, _, _, _, err := team.PipelineConfig("foo")
+  return err
+}
+
+func setConfig(team concourse.Team) error {
+  _, _, _, err := team.CreateOrUpdatePipelineConfig("foo", "1", []byte("jobs: []"), false)
+  return err
+}
+
+func destroyTeam(team concourse.Team) error {
+  return team.DestroyTeam("main")
+}
+
+func TestErrorKinds(t *testing.T) {
+  for _, c := range []struct {
+    status int
+    body   string
+    call   func(concourse.Team) error
+    kind   error
+    code   int
+  }{
+    {http.StatusUnauthorized, "", getConfig, ErrUnauthorized, http.StatusUnauthorized},
+    {http.StatusForbidden, "", getConfig, ErrForbidden, http.StatusForbidden},
+    {http.StatusForbidden, "", destroyTeam, ErrForbidden, http.StatusForbidden},
+    {http.StatusOK, `{"errors": ["bad"]}`, getConfig, ErrInvalidConfig, 0},
+    {http.StatusBadRequest, `{"errors": ["bad"]}`, setConfig, ErrInvalidConfig, http.StatusBadRequest},
+    {http.StatusNotFound, `{"errors": []}`, setConfig, ErrNotFound, http.StatusNotFound},
+    {http.StatusConflict, "", setConfig, ErrConflict, http.StatusConflict},
+    {http.StatusBadGateway, "", getConfig, ErrServerError, http.StatusBadGateway},
+  } {
+    concourseErr := concourseError(c.status, c.body, c.call)
+    assert.NotNil(t, concourseErr)
+
+    err := newAPIError(new(mocks.Target), concourseErr)
+    assert.True(t, errors.Is(err, c.kind), "Should map %T (%d) to %v", concourseErr, c.status, c.kind)
+    assert.Equal(t, c.code, err.(APIError).StatusCode, "Should find the status of %T", concourseErr)
+    assert.Equal(t, concourseErr, errors.Unwrap(err), "Should wrap %v", concourseErr)
+  }
+
+  err := newAPIError(new(mocks.Target), errors.New("connection refused"))
+  assert.Nil(t, err.(APIError).Kind, "Should not classify unknown errors")
+}
+
+func TestSetPipelineServerError(t *testing.T) {
+  err := concourseError(http.StatusInternalServerError, "", func(team concourse.Team) error {
+    target := new(mocks.Target)
+    target.On("Team").Return(team)
+    _, _, _, err := SetPipeline(target,
+      "foo",
+      []byte(``),
+      map[string]string{},
+      false)
+    return err
+  })
+  assert.True(t, errors.Is(err, ErrServerError), "Should classify server errors")
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+  authenticator := new(mocks.Authenticator)
+  authenticator.On("GetToken", mock.Anything,
+      mock.Anything, mock.Anything).Return((*rc.TargetToken)(nil), &oauth2.RetrieveError{
+        Response: &http.Response{StatusCode: http.StatusUnauthorized},
+      })
+  clientFactory := new(mocks.ClientFactory)
+  clientFactory.On("NewClient", mock.Anything,
+        mock.Anything, mock.Anything).Return(new(mocks.Client))
+  _, err := NewAuthenticatedTarget(
+    "foo",
+    "http://concourse.localhost/concourse",
+    "user",
+    "wrong",
+    "coolteam",
+    "",
+    true,
+    false,
+    clientFactory,
+    authenticator)
+  assert.True(t, errors.Is(err, ErrUnauthorized), "Should classify bad credentials")
+  var retrieveErr *oauth2.RetrieveError
+  assert.True(t, errors.As(err, &retrieveErr), "Should wrap the oauth2 error")
+}
+
+func TestBadConfigIsInvalidConfig(t *testing.T) {
+  _, err := ValidateConfig([]byte(`
+jobs:
+  - name: foo
+  - name: foo`),
+    []flaghelpers.VariablePairFlag{},
+    []flaghelpers.YAMLVariablePairFlag{},
+    []atc.PathFlag{},
+    false)
+  assert.True(t, errors.Is(err, ErrInvalidConfig), "Should match invalid config")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+  "regexp"
+)
+
+// Same syntax as fly's deprecated {{var}} templates
+var deprecatedVarRegex = regexp.MustCompile(`\{\{([-\w\p{L}]+)\}\}`)
+
+// EvaluationReport is the outcome of evaluating a pipeline config.
+type EvaluationReport struct {
+  // Config is the evaluated config, as sent to the ATC.
+  Config []byte
+
+  // UnusedVars are the provided variables the config never references.
+  UnusedVars []UnusedVar
+
+  // Provenance tells where each substituted variable came from.
+  Provenance []VarProvenance
+
+  // Redactor masks the values of sensitive variables. Use it before
+  // rendering Config anywhere but to the ATC.
+  Redactor *Redactor
+
+  // The sources Config was evaluated with, lowest precedence first
+  sources []loadedVarSource
+  // The config after ops files were applied, before templating, if any
+  patched []byte
+}
+
+// UnusedVar is a variable provided by Source that the config never
+// references. Source is the var file path for -l files.
+type UnusedVar struct {
+  Name   string
+  Source string
+}
+
+func deprecatedVarNames(configPayload []byte) map[string]bool {
+  names := map[string]bool{}
+  for _, match := range deprecatedVarRegex.FindAllSubmatch(configPayload, -1) {
+    names[string(match[1])] = true
+  }
+  return names
+}
+
+func unusedVars(sources []loadedVarSource, referenced map[string]bool) []UnusedVar {
+  unused := []UnusedVar{}
+  for _, source := range sources {
+    for _, name := range sortedVarNames(source.vars) {
+      if !referenced[name] {
+        unused = append(unused, UnusedVar{Name: name, Source: source.name})
+      }
+    }
+  }
+  return unused
+}
+
+// VarProvenance records which source provided a substituted variable, and
+// which lower precedence sources it shadowed. Values are redacted unless
+// EvaluateOptions.ShowVarValues is set.
+type VarProvenance struct {
+  Name     string
+  Source   string
+  Value    interface{}
+  Shadowed []ShadowedVar
+}
+
+type ShadowedVar struct {
+  Source string
+  Value  interface{}
+}
+
+func varProvenance(sources []loadedVarSource, referenced map[string]bool, showValues bool, sensitive SensitiveVars) ([]VarProvenance, error) {
+  provenance := []VarProvenance{}
+  for _, name := range sortedNames(referenced) {
+    var entry *VarProvenance
+    // Walk from the highest precedence source down
+    for i := len(sources) - 1; i >= 0; i-- {
+      value, found := sources[i].vars[name]
+      if !found {
+        continue
+      }
+
+      covered, err := sensitive.covers(name, sources[i].name)
+      if err != nil {
+        return nil, err
+      }
+      if !showValues || covered {
+        value = redacted
+      }
+
+      if entry == nil {
+        entry = &VarProvenance{
+          Name:     name,
+          Source:   sources[i].name,
+          Value:    value,
+          Shadowed: []ShadowedVar{},
+        }
+        continue
+      }
+
+      entry.Shadowed = append(entry.Shadowed, ShadowedVar{
+        Source: sources[i].name,
+        Value:  value,
+      })
+    }
+
+    if entry != nil {
+      provenance = append(provenance, *entry)
+    }
+  }
+
+  return provenance, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "reflect"
+  "strings"
+
+  yamlv3 "gopkg.in/yaml.v3"
+
+  "github.com/concourse/atc"
+  temp "github.com/concourse/fly/template"
+)
+
+// NotFormattedError is returned by FormatFile in check mode when a file is
+// not in canonical form.
+type NotFormattedError struct {
+  Path string
+}
+
+func (err NotFormattedError) Error() string {
+  return fmt.Sprintf("%s is not formatted", err.Path)
+}
+
+// Top-level lists sorted by name
+var sortedLists = []string{"resources", "resource_types"}
+
+// FormatConfig rewrites a pipeline config in canonical form: keys in the
+// order of atc.Config's fields, unknown keys last, resources and resource
+// types sorted by name, block style and two-space indentation. Nothing is
+// moved before the anchor of an alias it uses. Comments, anchors, scalar
+// quoting and ((var)) placeholders are kept.
+//
+// Old-style {{var}} placeholders are not YAML, and must be migrated with
+// MigrateTemplateStyle first.
+func FormatConfig(contents []byte) ([]byte, error) {
+  if temp.Present(contents) {
+    return nil, fmt.Errorf("cannot format a config with {{var}} placeholders; migrate them to ((var)) first")
+  }
+
+  var document yamlv3.Node
+  err := yamlv3.Unmarshal(contents, &document)
+  if err != nil {
+    return nil, err
+  }
+  if len(document.Content) == 0 {
+    return contents, nil
+  }
+
+  root := document.Content[0]
+  formatNode(root, reflect.TypeOf(atc.Config{}))
+  for _, list := range sortedLists {
+    sortByName(mappingValue(root, list))
+  }
+
+  return encodeYAMLNode(&document)
+}
+
+// FormatFile formats a config file in place and reports whether it changed.
+// In check mode the file is left untouched, and a NotFormattedError is
+// returned if it would change.
+func FormatFile(path string, check bool) (bool, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return false, err
+  }
+
+  contents, err := ioutil.ReadFile(path)
+  if err != nil {
+    return false, err
+  }
+
+  formatted, err := FormatConfig(contents)
+  if err != nil {
+    return false, fmt.Errorf("could not format %s: %s", path, err.Error())
+  }
+
+  if bytes.Equal(contents, formatted) {
+    return false, nil
+  }
+  if check {
+    return true, NotFormattedError{Path: path}
+  }
+
+  return true, ioutil.WriteFile(path, formatted, info.Mode())
+}
+
+// formatNode orders the keys of node like the fields of t, and recurses
+// into the values with the type of their field. Nodes without a known type
+// keep their key order.
+func formatNode(node *yamlv3.Node, t reflect.Type) {
+  for t != nil && t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+
+  switch node.Kind {
+  case yamlv3.MappingNode:
+    if len(node.Content) > 0 {
+      node.Style &^= yamlv3.FlowStyle
+    }
+
+    var fields map[string]reflect.StructField
+    var order []string
+    if t != nil && t.Kind() == reflect.Struct {
+      fields, order = yamlFields(t)
+      sortMappingKeys(node, order)
+    }
+
+    for i := 0; i+1 < len(node.Content); i += 2 {
+      var child reflect.Type
+      if t != nil {
+        switch t.Kind() {
+        case reflect.Struct:
+          if field, found := fields[node.Content[i].Value]; found {
+            child = field.Type
+          }
+        case reflect.Map:
+          child = t.Elem()
+        }
+      }
+      formatNode(node.Content[i+1], child)
+    }
+
+  case yamlv3.SequenceNode:
+    if len(node.Content) > 0 {
+      node.Style &^= yamlv3.FlowStyle
+    }
+
+    var child reflect.Type
+    if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+      child = t.Elem()
+    }
+    for _, item := range node.Content {
+      formatNode(item, child)
+    }
+  }
+}
+
+// yamlFields returns the fields of a struct by YAML key, and the keys in
+// field order.
+func yamlFields(t reflect.Type) (map[string]reflect.StructField, []string) {
+  fields := map[string]reflect.StructField{}
+  order := []string{}
+  for i := 0; i < t.NumField(); i++ {
+    field := t.Field(i)
+    name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+    if name == "-" || field.PkgPath != "" {
+      continue
+    }
+    if name == "" {
+      name = strings.ToLower(field.Name)
+    }
+    fields[name] = field
+    order = append(order, name)
+  }
+  return fields, order
+}
+
+// sortMappingKeys sorts the key/value pairs of node by their position in
+// order. Unknown keys go last, in their original order.
+func sortMappingKeys(node *yamlv3.Node, order []string) {
+  position := map[string]int{}
+  for i, key := range order {
+    position[key] = i
+  }
+  rank := func(key string) int {
+    // Merge keys stay first, where they are conventionally written
+    if key == "<<" {
+      return -1
+    }
+    if p, found := position[key]; found {
+      return p
+    }
+    return len(order)
+  }
+
+  pairs := [][]*yamlv3.Node{}
+  for i := 0; i+1 < len(node.Content); i += 2 {
+    pairs = append(pairs, []*yamlv3.Node{node.Content[i], node.Content[i+1]})
+  }
+  pairs = sortKeepingAnchors(pairs, func(i, j int) bool {
+    return rank(pairs[i][0].Value) < rank(pairs[j][0].Value)
+  })
+
+  node.Content = node.Content[:0]
+  for _, pair := range pairs {
+    node.Content = append(node.Content, pair...)
+  }
+}
+
+// sortKeepingAnchors sorts units of nodes stably with less, which compares
+// their original indexes, but never moves a unit using an alias before the
+// unit that defines its anchor, as the alias would no longer parse.
+func sortKeepingAnchors(units [][]*yamlv3.Node, less func(i, j int) bool) [][]*yamlv3.Node {
+  anchors := make([]map[*yamlv3.Node]bool, len(units))
+  aliases := make([]map[*yamlv3.Node]bool, len(units))
+  for i, unit := range units {
+    anchors[i], aliases[i] = map[*yamlv3.Node]bool{}, map[*yamlv3.Node]bool{}
+    for _, node := range unit {
+      collectAnchors(node, anchors[i], aliases[i])
+    }
+  }
+
+  placed := make([]bool, len(units))
+  blocks := func(j, i int) bool {
+    for target := range aliases[i] {
+      if j != i && !placed[j] && anchors[j][target] {
+        return true
+      }
+    }
+    return false
+  }
+
+  // A selection sort, as the order is partial. The unit defining an anchor
+  // is pulled forward just before the first unit that needs it; it is always
+  // earlier in the original order, so this ends.
+  sorted := make([][]*yamlv3.Node, 0, len(units))
+  for len(sorted) < len(units) {
+    next := -1
+    for i := range units {
+      if !placed[i] && (next == -1 || less(i, next)) {
+        next = i
+      }
+    }
+    for {
+      blocker := -1
+      for j := range units {
+        if blocks(j, next) && (blocker == -1 || less(j, blocker)) {
+          blocker = j
+        }
+      }
+      if blocker == -1 {
+        break
+      }
+      next = blocker
+    }
+
+    placed[next] = true
+    sorted = append(sorted, units[next])
+  }
+  return sorted
+}
+
+func collectAnchors(node *yamlv3.Node, anchors map[*yamlv3.Node]bool, aliases map[*yamlv3.Node]bool) {
+  if node.Kind == yamlv3.AliasNode {
+    aliases[node.Alias] = true
+    return
+  }
+  if node.Anchor != "" {
+    anchors[node] = true
+  }
+  for _, child := range node.Content {
+    collectAnchors(child, anchors, aliases)
+  }
+}
+
+func sortByName(list *yamlv3.Node) {
+  if list == nil || list.Kind != yamlv3.SequenceNode {
+    return
+  }
+
+  name := func(item *yamlv3.Node) string {
+    if nameNode := mappingValue(item, "name"); nameNode != nil {
+      return nameNode.Value
+    }
+    return ""
+  }
+  items := [][]*yamlv3.Node{}
+  for _, item := range list.Content {
+    items = append(items, []*yamlv3.Node{item})
+  }
+  items = sortKeepingAnchors(items, func(i, j int) bool {
+    return name(items[i][0]) < name(items[j][0])
+  })
+
+  for i, item := range items {
+    list.Content[i] = item[0]
+  }
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+const unformattedConfig = `jobs:
+- plan:
+    - {task: build, file: repo/build.yml, input_mapping: {source: repo}}
+    # fetch sources
+    - trigger: true
+      get: repo
+  name: build
+  serial: true
+resources:
+    # release tarballs
+    - source:
+        bucket: ((bucket))
+      type: s3
+      name: release
+    - {name: repo, type: git, source: {uri: ((uri))}}
+groups: [{name: all, jobs: [build]}]
+`
+
+const formattedConfig = `groups:
+  - name: all
+    jobs:
+      - build
+resources:
+  # release tarballs
+  - name: release
+    type: s3
+    source:
+      bucket: ((bucket))
+  - name: repo
+    type: git
+    source:
+      uri: ((uri))
+jobs:
+  - name: build
+    serial: true
+    plan:
+      - task: build
+        file: repo/build.yml
+        input_mapping:
+          source: repo
+      # fetch sources
+      - get: repo
+        trigger: true
+`
+
+func TestFormatConfig(t *testing.T) {
+  formatted, err := FormatConfig([]byte(unformattedConfig))
+  assert.Nil(t, err)
+  assert.Equal(t, formattedConfig, string(formatted), "Should order keys like atc.Config")
+
+  again, err := FormatConfig(formatted)
+  assert.Nil(t, err)
+  assert.Equal(t, string(formatted), string(again), "Should be idempotent")
+
+  formatted, err = FormatConfig([]byte("defaults: &git {type: git}\nresources:\n  - name: repo\n    <<: *git\n"))
+  assert.Nil(t, err)
+  assert.Equal(t, "defaults: &git\n  type: git\nresources:\n  - <<: *git\n    name: repo\n", string(formatted),
+    "Should keep merge keys first, and anchors before their aliases")
+
+  _, err = FormatConfig([]byte("jobs:\n  - name: {{job}}\n"))
+  assert.Error(t, err, "Should refuse old-style placeholders")
+}
+
+func TestFormatConfigKeepsAnchorsParseable(t *testing.T) {
+  config := `x-template: &template
+  type: git
+jobs:
+  - name: unit
+    plan: [get: repo]
+resource_types: []
+resources:
+  - name: tools
+    type: git
+    source: &source {uri: ((uri))}
+  - name: repo
+    <<: *template
+    source: *source
+`
+  formatted, err := FormatConfig([]byte(config))
+  assert.Nil(t, err)
+  assert.Equal(t, `x-template: &template
+  type: git
+resources:
+  - name: tools
+    type: git
+    source: &source
+      uri: ((uri))
+  - <<: *template
+    name: repo
+    source: *source
+resource_types: []
+jobs:
+  - name: unit
+    plan:
+      - get: repo
+`, string(formatted), "Should not move anchors after their aliases")
+
+  var parsed interface{}
+  assert.Nil(t, yaml.Unmarshal(formatted, &parsed), "Should format into YAML that still parses")
+  evaluated, err := EvaluateConfigWithOptions(formatted, EvaluateOptions{
+    Sources: []VarSource{stringMapSource(map[string]string{"uri": "git@example.com:repo"})},
+  })
+  assert.Nil(t, err)
+  var evaluatedConfig atc.Config
+  assert.Nil(t, yaml.Unmarshal(evaluated, &evaluatedConfig))
+  assert.Equal(t, "git", evaluatedConfig.Resources[1].Type)
+  assert.Equal(t, "git@example.com:repo", evaluatedConfig.Resources[1].Source["uri"])
+}
+
+func TestFormatFileCheck(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "format")
+  defer os.RemoveAll(dir)
+  path := writeTempFile(t, dir, "pipeline.yml", unformattedConfig)
+
+  changed, err := FormatFile(path, true)
+  assert.True(t, changed)
+  assert.Equal(t, NotFormattedError{Path: path}, err)
+  contents, _ := ioutil.ReadFile(path)
+  assert.Equal(t, unformattedConfig, string(contents), "Should not write in check mode")
+
+  changed, err = FormatFile(path, false)
+  assert.True(t, changed)
+  assert.Nil(t, err)
+
+  changed, err = FormatFile(path, true)
+  assert.False(t, changed)
+  assert.Nil(t, err)
+}
@@ -11,7 +11,7 @@ require (
 	github.com/concourse/atc v4.2.2+incompatible
 	github.com/concourse/fly v4.2.5+incompatible
 	github.com/concourse/go-concourse v4.2.2+incompatible
-	github.com/cppforlife/go-patch v0.2.0 // indirect
+	github.com/cppforlife/go-patch v0.2.0
 	github.com/cppforlife/go-semi-semantic v0.0.0-20160921010311-576b6af77ae4
 	github.com/fatih/color v1.7.0 // indirect
 	github.com/google/jsonapi v0.0.0-20181016150055-d0428f63eb51 // indirect
@@ -25,6 +25,9 @@ require (
 	github.com/tedsuo/rata v1.0.0 // indirect
 	github.com/vektra/mockery v0.0.0-20181123154057-e78b021dcbb5 // indirect
 	github.com/vito/go-sse v1.0.0 // indirect
+	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/net v0.0.0-20190108225652-1e06a53dbb7e
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,199 @@
+package main
+
+import (
+  "context"
+  "io"
+  "net/http"
+  "sync"
+  "time"
+)
+
+// RateLimit bounds the traffic a target sends to the ATC. A zero
+// RequestsPerSecond or MaxInFlight leaves that dimension unlimited.
+type RateLimit struct {
+  RequestsPerSecond float64
+  Burst             int
+  MaxInFlight       int
+}
+
+type limiter struct {
+  bucket   *tokenBucket
+  inFlight chan struct{}
+}
+
+func newLimiter(limit RateLimit) *limiter {
+  l := &limiter{}
+  if limit.RequestsPerSecond > 0 {
+    l.bucket = newTokenBucket(limit.RequestsPerSecond, limit.Burst)
+  }
+  if limit.MaxInFlight > 0 {
+    l.inFlight = make(chan struct{}, limit.MaxInFlight)
+  }
+  return l
+}
+
+// acquire blocks until the request may be sent. The returned function must
+// be called once the request is done.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+  if l.inFlight != nil {
+    select {
+    case l.inFlight <- struct{}{}:
+    case <-ctx.Done():
+      return nil, ctx.Err()
+    }
+  }
+
+  release := func() {
+    if l.inFlight != nil {
+      <-l.inFlight
+    }
+  }
+
+  if l.bucket != nil {
+    if err := l.bucket.wait(ctx); err != nil {
+      release()
+      return nil, err
+    }
+  }
+
+  return release, nil
+}
+
+type tokenBucket struct {
+  lock   sync.Mutex
+  rate   float64
+  burst  float64
+  tokens float64
+  last   time.Time
+
+  // The clock, replaced in tests
+  now   func() time.Time
+  after func(time.Duration) <-chan time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+  if burst < 1 {
+    burst = 1
+  }
+  return &tokenBucket{
+    rate:   rate,
+    burst:  float64(burst),
+    tokens: float64(burst),
+    last:   time.Now(),
+    now:    time.Now,
+    after:  time.After,
+  }
+}
+
+// reserve takes a token, possibly going into debt, and returns how long the
+// caller has to wait before the token is actually available.
+func (b *tokenBucket) reserve() time.Duration {
+  b.lock.Lock()
+  defer b.lock.Unlock()
+
+  now := b.now()
+  b.tokens += now.Sub(b.last).Seconds() * b.rate
+  if b.tokens > b.burst {
+    b.tokens = b.burst
+  }
+  b.last = now
+
+  b.tokens--
+  if b.tokens >= 0 {
+    return 0
+  }
+  return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) cancel() {
+  b.lock.Lock()
+  defer b.lock.Unlock()
+  b.tokens++
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+  delay := b.reserve()
+  if delay == 0 {
+    return nil
+  }
+
+  select {
+  case <-b.after(delay):
+    return nil
+  case <-ctx.Done():
+    b.cancel()
+    return ctx.Err()
+  }
+}
+
+// LimitTransport throttles requests before handing them to Base. Mutating
+// requests (pipeline config uploads, pauses, renames...) go through the
+// mutating limit first, which is usually the stricter one, and then through
+// the general one.
+type LimitTransport struct {
+  Base     http.RoundTripper
+  all      *limiter
+  mutating *limiter
+}
+
+func NewLimitTransport(base http.RoundTripper, limit RateLimit, mutatingLimit RateLimit) *LimitTransport {
+  return &LimitTransport{
+    Base:     base,
+    all:      newLimiter(limit),
+    mutating: newLimiter(mutatingLimit),
+  }
+}
+
+func (t *LimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  releases := []func(){}
+  releaseAll := func() {
+    for _, release := range releases {
+      release()
+    }
+  }
+
+  limiters := []*limiter{t.all}
+  if isMutating(req.Method) {
+    limiters = []*limiter{t.mutating, t.all}
+  }
+
+  for _, l := range limiters {
+    release, err := l.acquire(req.Context())
+    if err != nil {
+      releaseAll()
+      return nil, err
+    }
+    releases = append(releases, release)
+  }
+
+  resp, err := t.Base.RoundTrip(req)
+  if err != nil {
+    releaseAll()
+    return nil, err
+  }
+
+  // The request stays in flight until its response has been read.
+  resp.Body = &releasingBody{ReadCloser: resp.Body, release: releaseAll}
+  return resp, nil
+}
+
+type releasingBody struct {
+  io.ReadCloser
+  release func()
+  once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+  err := b.ReadCloser.Close()
+  b.once.Do(b.release)
+  return err
+}
+
+func isMutating(method string) bool {
+  switch method {
+  case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+    return true
+  default:
+    return false
+  }
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestMaxInFlight(t *testing.T) {
+  var inFlight, peak int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    n := atomic.AddInt32(&inFlight, 1)
+    for {
+      p := atomic.LoadInt32(&peak)
+      if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+        break
+      }
+    }
+    time.Sleep(20 * time.Millisecond)
+    atomic.AddInt32(&inFlight, -1)
+  }))
+  defer server.Close()
+
+  client := &http.Client{Transport: NewLimitTransport(http.DefaultTransport,
+    RateLimit{MaxInFlight: 2}, RateLimit{})}
+  var wg sync.WaitGroup
+  for i := 0; i < 6; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      resp, err := client.Get(server.URL)
+      if assert.Nil(t, err) {
+        resp.Body.Close()
+      }
+    }()
+  }
+  wg.Wait()
+  assert.Equal(t, int32(2), atomic.LoadInt32(&peak), "Should never exceed max in flight")
+}
+
+// fakeClock records the waits of a tokenBucket and lets them pass at once,
+// moving time forward as if they had been waited.
+type fakeClock struct {
+  lock  sync.Mutex
+  now   time.Time
+  waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+  return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+  c.waits = append(c.waits, d)
+  c.now = c.now.Add(d)
+  fired := make(chan time.Time, 1)
+  fired <- c.now
+  return fired
+}
+
+func TestMutatingRateLimit(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+  defer server.Close()
+
+  transport := NewLimitTransport(http.DefaultTransport,
+    RateLimit{}, RateLimit{RequestsPerSecond: 20, Burst: 1})
+  bucket := transport.mutating.bucket
+  clock := &fakeClock{now: bucket.last}
+  bucket.now, bucket.after = clock.Now, clock.After
+  client := &http.Client{Transport: transport}
+
+  for i := 0; i < 5; i++ {
+    resp, err := client.Get(server.URL)
+    assert.Nil(t, err)
+    resp.Body.Close()
+  }
+  assert.Empty(t, clock.waits, "Should not throttle reads")
+
+  for i := 0; i < 3; i++ {
+    req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("jobs: []"))
+    resp, err := client.Do(req)
+    assert.Nil(t, err)
+    resp.Body.Close()
+  }
+  assert.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond}, clock.waits, "Should throttle mutating calls past the burst")
+}
+
+func TestRateLimitHonorsContext(t *testing.T) {
+  bucket := newTokenBucket(1, 1)
+  assert.Nil(t, bucket.wait(context.Background()), "Should grant the burst immediately")
+
+  ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+  defer cancel()
+  assert.Equal(t, context.DeadlineExceeded, bucket.wait(ctx), "Should give up when the context is done")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/concourse/atc"
+)
+
+// SeverityOff disables a lint rule in LintOptions.Severities.
+const SeverityOff Severity = "off"
+
+// LintRule checks a pipeline config for patterns that are valid but
+// discouraged. Custom rules can be written with NewLintRule.
+type LintRule interface {
+  Name() string
+  // Severity is used unless LintOptions.Severities overrides it
+  Severity() Severity
+  Check(config atc.Config) []LintFinding
+}
+
+// LintFinding is a single problem found by a rule. Identifier uses the same
+// form as atc's validation messages, such as "jobs.deploy.plan[1]" or
+// "resources.repo", so that the finding can be located in the config file.
+type LintFinding struct {
+  Identifier string
+  Message    string
+}
+
+type lintRule struct {
+  name     string
+  severity Severity
+  check    func(atc.Config) []LintFinding
+}
+
+func (r lintRule) Name() string                          { return r.name }
+func (r lintRule) Severity() Severity                    { return r.severity }
+func (r lintRule) Check(config atc.Config) []LintFinding { return r.check(config) }
+
+func NewLintRule(name string, severity Severity, check func(atc.Config) []LintFinding) LintRule {
+  return lintRule{name: name, severity: severity, check: check}
+}
+
+// LintOptions enables linting in ValidateConfigWithOptions.
+//
+// Findings can be suppressed from the config itself with a comment on the
+// flagged line or the line above it:
+//
+//   # lint:ignore public-job
+//   - name: docs
+//     public: true
+//
+// "# lint:ignore" alone suppresses every rule, and "# lint:ignore-file RULE"
+// anywhere in the file suppresses a rule for the whole file.
+type LintOptions struct {
+  // Rules defaults to BuiltinLintRules(). To add custom rules, append them to
+  // BuiltinLintRules().
+  Rules []LintRule
+
+  // Severities overrides the severity of rules by name. SeverityOff
+  // disables a rule.
+  Severities map[string]Severity
+}
+
+func (options LintOptions) run(config atc.Config, locator *configLocator) ([]ConfigIssue, error) {
+  rules := options.Rules
+  if rules == nil {
+    rules = BuiltinLintRules()
+  }
+
+  known := map[string]bool{}
+  for _, rule := range rules {
+    known[rule.Name()] = true
+  }
+  for name, severity := range options.Severities {
+    if !known[name] {
+      return nil, fmt.Errorf("unknown lint rule '%s'", name)
+    }
+    switch severity {
+    case SeverityError, SeverityWarning, SeverityOff:
+    default:
+      return nil, fmt.Errorf("invalid severity '%s' for lint rule '%s'", severity, name)
+    }
+  }
+
+  issues := []ConfigIssue{}
+  for _, rule := range rules {
+    severity := rule.Severity()
+    if override, ok := options.Severities[rule.Name()]; ok {
+      severity = override
+    }
+    if severity == SeverityOff {
+      continue
+    }
+
+    for _, finding := range rule.Check(config) {
+      issue := locator.findingIssue(rule.Name(), severity, finding)
+      if locator.suppressed(rule.Name(), issue.Location) {
+        continue
+      }
+      issues = append(issues, issue)
+    }
+  }
+
+  return issues, nil
+}
+
+func (l *configLocator) findingIssue(rule string, severity Severity, finding LintFinding) ConfigIssue {
+  message := finding.Message
+  if finding.Identifier != "" {
+    message = finding.Identifier + " " + message
+  }
+
+  return ConfigIssue{
+    Severity: severity,
+    Message:  message,
+    Location: l.locate(message),
+    Rule:     rule,
+  }
+}
+
+var suppressionRegex = regexp.MustCompile(`#\s*lint:(ignore(?:-file)?)\b([^#]*)`)
+
+// suppressed reports whether a lint:ignore comment covers rule at location.
+func (l *configLocator) suppressed(rule string, location ConfigLocation) bool {
+  for _, line := range l.lines {
+    if match := suppressionRegex.FindStringSubmatch(line); match != nil && match[1] == "ignore-file" {
+      if suppressionCovers(match[2], rule) {
+        return true
+      }
+    }
+  }
+
+  if location.Line == 0 {
+    return false
+  }
+
+  for _, lineNumber := range []int{location.Line, location.Line - 1} {
+    if lineNumber < 1 || lineNumber > len(l.lines) {
+      continue
+    }
+    match := suppressionRegex.FindStringSubmatch(l.lines[lineNumber-1])
+    if match != nil && match[1] == "ignore" && suppressionCovers(match[2], rule) {
+      return true
+    }
+  }
+
+  return false
+}
+
+func suppressionCovers(rules string, rule string) bool {
+  names := strings.FieldsFunc(rules, func(r rune) bool {
+    return r == ',' || r == ' ' || r == '\t'
+  })
+  if len(names) == 0 {
+    return true
+  }
+  for _, name := range names {
+    if name == rule {
+      return true
+    }
+  }
+  return false
+}
+
+// walkJobPlans calls fn for every step of a job, hooks included, with the
+// step's identifier as atc's validation builds it.
+func walkJobPlans(job atc.JobConfig, fn func(identifier string, step atc.PlanConfig)) {
+  identifier := "jobs." + job.Name
+  walkPlan(identifier+".plan", atc.PlanConfig{Do: &job.Plan}, false, fn)
+
+  hooks := []struct {
+    name string
+    plan *atc.PlanConfig
+  }{
+    {"abort", job.Abort},
+    {"failure", job.Failure},
+    {"ensure", job.Ensure},
+    {"success", job.Success},
+  }
+  for _, hook := range hooks {
+    if hook.plan != nil {
+      walkPlan(identifier+"."+hook.name, *hook.plan, true, fn)
+    }
+  }
+}
+
+func walkPlan(identifier string, plan atc.PlanConfig, visit bool, fn func(string, atc.PlanConfig)) {
+  switch {
+  case plan.Do != nil:
+    if visit {
+      fn(identifier, plan)
+    }
+    for i, step := range *plan.Do {
+      walkPlan(fmt.Sprintf("%s[%d]", identifier, i), step, true, fn)
+    }
+  case plan.Aggregate != nil:
+    fn(identifier, plan)
+    for i, step := range *plan.Aggregate {
+      walkPlan(fmt.Sprintf("%s.aggregate[%d]", identifier, i), step, true, fn)
+    }
+  case plan.Get != "":
+    identifier = fmt.Sprintf("%s.get.%s", identifier, plan.Get)
+    fn(identifier, plan)
+  case plan.Put != "":
+    identifier = fmt.Sprintf("%s.put.%s", identifier, plan.Put)
+    fn(identifier, plan)
+  case plan.Task != "":
+    identifier = fmt.Sprintf("%s.task.%s", identifier, plan.Task)
+    fn(identifier, plan)
+  case plan.Try != nil:
+    fn(identifier, plan)
+    walkPlan(identifier+".try", *plan.Try, true, fn)
+  }
+
+  hooks := []struct {
+    name string
+    plan *atc.PlanConfig
+  }{
+    {"abort", plan.Abort},
+    {"ensure", plan.Ensure},
+    {"success", plan.Success},
+    {"failure", plan.Failure},
+  }
+  for _, hook := range hooks {
+    if hook.plan != nil {
+      walkPlan(identifier+"."+hook.name, *hook.plan, true, fn)
+    }
+  }
+}
+
+// stepResource returns the resource a get or put step uses.
+func stepResource(step atc.PlanConfig) string {
+  if step.Resource != "" {
+    return step.Resource
+  }
+  if step.Get != "" {
+    return step.Get
+  }
+  return step.Put
+}
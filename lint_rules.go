@@ -0,0 +1,167 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/concourse/atc"
+)
+
+const (
+  LintUnpinnedImage    = "unpinned-image"
+  LintPublicJob        = "public-job"
+  LintUnusedResource   = "unused-resource"
+  LintResourceNotInput = "resource-never-input"
+  LintDeployNotSerial  = "deploy-not-serial"
+)
+
+// Put and task steps whose name matches this are considered deployments
+var deployRegex = regexp.MustCompile(`(?i)deploy`)
+
+// BuiltinLintRules returns the rules run by default. They all report
+// warnings.
+func BuiltinLintRules() []LintRule {
+  return []LintRule{
+    NewLintRule(LintUnpinnedImage, SeverityWarning, lintUnpinnedImages),
+    NewLintRule(LintPublicJob, SeverityWarning, lintPublicJobs),
+    NewLintRule(LintUnusedResource, SeverityWarning, lintUnusedResources),
+    NewLintRule(LintResourceNotInput, SeverityWarning, lintResourcesNeverInputs),
+    NewLintRule(LintDeployNotSerial, SeverityWarning, lintDeployJobsNotSerial),
+  }
+}
+
+// lintUnpinnedImages flags inline task images that follow a moving tag, so
+// that the same build may run in different images.
+func lintUnpinnedImages(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  for _, job := range config.Jobs {
+    walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+      if step.TaskConfig == nil || step.TaskConfig.ImageResource == nil {
+        return
+      }
+
+      image := step.TaskConfig.ImageResource
+      if image.Type != "docker-image" && image.Type != "registry-image" {
+        return
+      }
+      if image.Version != nil && len(*image.Version) > 0 {
+        return
+      }
+
+      repository, _ := image.Source["repository"].(string)
+      if strings.Contains(repository, "@sha256:") {
+        return
+      }
+
+      tag := fmt.Sprintf("%v", image.Source["tag"])
+      if image.Source["tag"] == nil || tag == "" || tag == "latest" {
+        findings = append(findings, LintFinding{
+          Identifier: identifier,
+          Message:    fmt.Sprintf("uses image '%s' without pinning a tag", repository),
+        })
+      }
+    })
+  }
+  return findings
+}
+
+func lintPublicJobs(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  for _, job := range config.Jobs {
+    if job.Public {
+      findings = append(findings, LintFinding{
+        Identifier: "jobs." + job.Name,
+        Message:    "is public, so anyone can read its build logs",
+      })
+    }
+  }
+  return findings
+}
+
+// resourceUsage returns, per resource, whether some step gets it and
+// whether some step puts it.
+func resourceUsage(config atc.Config) (map[string]bool, map[string]bool) {
+  gets, puts := map[string]bool{}, map[string]bool{}
+  for _, job := range config.Jobs {
+    walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+      switch {
+      case step.Get != "":
+        gets[stepResource(step)] = true
+      case step.Put != "":
+        puts[stepResource(step)] = true
+      }
+    })
+  }
+  return gets, puts
+}
+
+// lintUnusedResources overlaps with atc's own validation, which rejects
+// unused resources, so that lint findings are complete on their own.
+func lintUnusedResources(config atc.Config) []LintFinding {
+  gets, puts := resourceUsage(config)
+
+  findings := []LintFinding{}
+  for _, resource := range config.Resources {
+    if !gets[resource.Name] && !puts[resource.Name] {
+      findings = append(findings, LintFinding{
+        Identifier: "resources." + resource.Name,
+        Message:    "is not used by any job",
+      })
+    }
+  }
+  return findings
+}
+
+// lintResourcesNeverInputs flags resources that are only ever put, which
+// usually means a get step is missing. Unused resources are left to
+// lintUnusedResources.
+func lintResourcesNeverInputs(config atc.Config) []LintFinding {
+  gets, puts := resourceUsage(config)
+
+  findings := []LintFinding{}
+  for _, resource := range config.Resources {
+    if puts[resource.Name] && !gets[resource.Name] {
+      findings = append(findings, LintFinding{
+        Identifier: "resources." + resource.Name,
+        Message:    "is never used as an input",
+      })
+    }
+  }
+  return findings
+}
+
+// lintDeployJobsNotSerial flags jobs that deploy but may run several builds
+// at once, which lets deployments race each other.
+func lintDeployJobsNotSerial(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  for _, job := range config.Jobs {
+    if job.MaxInFlight() == 1 {
+      continue
+    }
+
+    if deployStep := findDeployStep(job); deployStep != "" {
+      findings = append(findings, LintFinding{
+        Identifier: deployStep,
+        Message:    "deploys from a job that is not serial",
+      })
+    }
+  }
+  return findings
+}
+
+// findDeployStep returns the identifier of the first step of job that
+// deploys, or "" if there is none.
+func findDeployStep(job atc.JobConfig) string {
+  deployStep := ""
+  walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+    if deployStep != "" {
+      return
+    }
+    if (step.Put != "" && (deployRegex.MatchString(step.Put) || deployRegex.MatchString(step.Resource))) ||
+      (step.Task != "" && deployRegex.MatchString(step.Task)) {
+      deployStep = identifier
+    }
+  })
+  return deployStep
+}
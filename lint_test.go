@@ -0,0 +1,100 @@
+package main
+
+import (
+  "errors"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+)
+
+const lintedConfig = `jobs:
+  - name: deploy
+    public: true
+    plan:
+      - get: repo
+      - task: build
+        config:
+          platform: linux
+          image_resource:
+            type: docker-image
+            source: {repository: golang}
+          run: {path: make}
+      - put: deploy-production
+        params: {file: repo/app}
+  # lint:ignore public-job
+  - name: docs
+    public: true
+    plan:
+      - get: repo
+resources:
+  - name: repo
+    type: git
+  - name: deploy-production # lint:ignore resource-never-input
+    type: cf
+`
+
+func TestLintConfig(t *testing.T) {
+  warnings, err := ValidateConfigWithOptions([]byte(lintedConfig), ValidateOptions{
+    ConfigPath: "pipeline.yml",
+    Lint: &LintOptions{},
+  })
+  assert.Nil(t, err)
+  assert.Equal(t, []atc.Warning{
+    {Type: "lint", Message: "jobs.deploy.plan[1].task.build uses image 'golang' without pinning a tag"},
+    {Type: "lint", Message: "jobs.deploy is public, so anyone can read its build logs"},
+    {Type: "lint", Message: "jobs.deploy.plan[2].put.deploy-production deploys from a job that is not serial"},
+  }, warnings, "Should report lint warnings not suppressed by comments")
+}
+
+func TestLintSeverities(t *testing.T) {
+  noTags := NewLintRule("no-tags", SeverityWarning, func(config atc.Config) []LintFinding {
+    findings := []LintFinding{}
+    for _, resource := range config.Resources {
+      if len(resource.Tags) == 0 {
+        findings = append(findings, LintFinding{Identifier: "resources." + resource.Name, Message: "has no tags"})
+      }
+    }
+    return findings
+  })
+
+  _, err := ValidateConfigWithOptions([]byte(lintedConfig), ValidateOptions{
+    ConfigPath: "pipeline.yml",
+    Lint: &LintOptions{
+      Rules: append(BuiltinLintRules(), noTags),
+      Severities: map[string]Severity{
+        LintPublicJob: SeverityError,
+        LintUnpinnedImage: SeverityOff,
+        LintResourceNotInput: SeverityOff,
+        LintDeployNotSerial: SeverityOff,
+        "no-tags": SeverityError,
+      },
+    },
+  })
+  assert.True(t, errors.Is(err, ErrInvalidConfig), "Should fail on lint errors")
+  assert.Equal(t, []ConfigIssue{
+    {
+      Severity: SeverityError,
+      Message: "jobs.deploy is public, so anyone can read its build logs",
+      Location: ConfigLocation{"pipeline.yml", 2, 5},
+      Rule: LintPublicJob,
+    },
+    {
+      Severity: SeverityError,
+      Message: "resources.repo has no tags",
+      Location: ConfigLocation{"pipeline.yml", 21, 5},
+      Rule: "no-tags",
+    },
+    {
+      Severity: SeverityError,
+      Message: "resources.deploy-production has no tags",
+      Location: ConfigLocation{"pipeline.yml", 23, 5},
+      Rule: "no-tags",
+    },
+  }, err.(BadConfigError).Issues, "Should apply per-rule severities to custom and builtin rules")
+  assert.Contains(t, err.Error(), "pipeline.yml:2:5: jobs.deploy is public, so anyone can read its build logs [public-job]")
+
+  _, err = ValidateConfigWithOptions([]byte(lintedConfig), ValidateOptions{
+    Lint: &LintOptions{Severities: map[string]Severity{"missing": SeverityOff}},
+  })
+  assert.EqualError(t, err, "unknown lint rule 'missing'")
+}
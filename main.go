@@ -1,8 +1,10 @@
 package main
 
 import (
+  "errors"
   "log"
   "io/ioutil"
+  "os"
 )
 
 const (
@@ -24,6 +26,16 @@ var vars = map[string]string{
 }
 
 func main() {
+  // "schema" prints the pipeline JSON Schema, for editors and hooks
+  if len(os.Args) > 1 && os.Args[1] == "schema" {
+    schema, err := PipelineJSONSchema()
+    if err != nil {
+      log.Fatalf("Could not generate schema: %s", err.Error())
+    }
+    os.Stdout.Write(schema)
+    return
+  }
+
   target, err := NewAuthenticatedTarget(targetName, atcUrl, username, password,
       team, caCert, insecure, tracing, &ConcourseClientFactory{},
       &OAuth2Authenticator{});
@@ -37,7 +49,7 @@ func main() {
 	}
 
   _, _, _, err = SetPipeline(target, pipelineName, evaluatedConfig, vars, false)
-  if err != nil {
+  if err != nil && !errors.Is(err, ErrPipelineUnchanged) {
     log.Fatalf("Could not set pipeline: %s", err.Error())
   }
 
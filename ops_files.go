@@ -0,0 +1,138 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+
+  "github.com/cppforlife/go-patch/patch"
+  temp "github.com/concourse/fly/template"
+)
+
+// OpsFile is a list of BOSH-style go-patch operations, as in:
+//
+//   - type: replace
+//     path: /jobs/name=deploy/serial?
+//     value: true
+//   - type: remove
+//     path: /resources/name=staging-env
+//
+// An OpsFile with only its Path set is read when it is applied; LoadOpsFile
+// and ParseOpsFile report errors up front.
+type OpsFile struct {
+  Path string
+
+  parsed      bool
+  definitions []patch.OpDefinition
+  ops         patch.Ops
+}
+
+// OpsError is an operation that could not be parsed or applied.
+type OpsError struct {
+  File  string
+  Index int
+  Type  string
+  Path  string
+  Err   error
+}
+
+func (err OpsError) Error() string {
+  return fmt.Sprintf("ops file %s: operation [%d] (%s %s): %s", err.File, err.Index, err.Type, err.Path, err.Err.Error())
+}
+
+func (err OpsError) Unwrap() error {
+  return err.Err
+}
+
+func (err OpsError) Is(target error) bool {
+  return target == ErrInvalidConfig
+}
+
+func LoadOpsFile(path string) (OpsFile, error) {
+  contents, err := ioutil.ReadFile(path)
+  if err != nil {
+    return OpsFile{}, fmt.Errorf("could not read ops file (%s): %s", path, err.Error())
+  }
+
+  return ParseOpsFile(path, contents)
+}
+
+// ParseOpsFile parses an ops file. path is only used in errors.
+func ParseOpsFile(path string, contents []byte) (OpsFile, error) {
+  file := OpsFile{Path: path, parsed: true}
+  err := yaml.Unmarshal(contents, &file.definitions)
+  if err != nil {
+    return OpsFile{}, fmt.Errorf("could not parse ops file (%s): %s", path, err.Error())
+  }
+
+  for i, definition := range file.definitions {
+    // Parse one at a time, so that errors can be reported like apply's
+    op, err := patch.NewOpsFromDefinitions([]patch.OpDefinition{definition})
+    if err != nil {
+      return OpsFile{}, file.opsError(i, opDefinitionError(err))
+    }
+    file.ops = append(file.ops, op[0])
+  }
+
+  return file, nil
+}
+
+// opDefinitionError strips go-patch's operation index and dump, which
+// OpsError replaces, from a parsing error.
+func opDefinitionError(err error) error {
+  message := strings.SplitN(err.Error(), " within\n", 2)[0]
+  parts := strings.SplitN(message, ": ", 2)
+  if len(parts) < 2 {
+    return errors.New("unknown operation type")
+  }
+  return errors.New(parts[1])
+}
+
+func (file OpsFile) opsError(i int, err error) OpsError {
+  definition := file.definitions[i]
+  opsErr := OpsError{File: file.Path, Index: i, Type: definition.Type, Err: err}
+  if definition.Path != nil {
+    opsErr.Path = *definition.Path
+  }
+  return opsErr
+}
+
+// applyOpsFiles applies every operation of files in order. The config is
+// re-encoded, so it is left untouched when there is nothing to apply.
+func applyOpsFiles(configPayload []byte, files []OpsFile) ([]byte, error) {
+  if len(files) == 0 {
+    return configPayload, nil
+  }
+
+  // {{var}} is not YAML, and would not survive being re-encoded
+  if temp.Present(configPayload) {
+    return nil, fmt.Errorf("cannot apply ops files to a config with {{var}} placeholders; migrate them to ((var)) first")
+  }
+
+  var config interface{}
+  err := yaml.Unmarshal(configPayload, &config)
+  if err != nil {
+    return nil, err
+  }
+
+  for _, file := range files {
+    if !file.parsed {
+      file, err = LoadOpsFile(file.Path)
+      if err != nil {
+        return nil, err
+      }
+    }
+
+    for i, op := range file.ops {
+      config, err = op.Apply(config)
+      if err != nil {
+        return nil, file.opsError(i, err)
+      }
+    }
+  }
+
+  return yaml.Marshal(config)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/ribaptista/concourse-poc/mocks"
+  "github.com/concourse/go-concourse/concourse"
+  yaml "gopkg.in/yaml.v2"
+)
+
+const baseConfig = `jobs:
+  - name: deploy
+    plan:
+      - get: repo
+resources:
+  - name: repo
+    type: git
+    source: {uri: ((repo))}
+`
+
+func TestApplyOpsFiles(t *testing.T) {
+  serial, err := ParseOpsFile("serial.yml", []byte(`
+- type: replace
+  path: /jobs/name=deploy/serial?
+  value: true
+`))
+  assert.Nil(t, err)
+  branch, err := ParseOpsFile("branch.yml", []byte(`
+- type: replace
+  path: /resources/name=repo/source/branch?
+  value: ((branch))
+`))
+  assert.Nil(t, err)
+
+  config, err := EvaluateConfigWithOptions([]byte(baseConfig), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{"repo": "git@example.com:app", "branch": "staging"}},
+    },
+    OpsFiles: []OpsFile{serial, branch},
+  })
+  assert.Nil(t, err)
+
+  var evaluated atc.Config
+  yaml.Unmarshal(config, &evaluated)
+  assert.True(t, evaluated.Jobs[0].Serial, "Should apply the first ops file")
+  assert.Equal(t, "staging", evaluated.Resources[0].Source["branch"], "Should interpolate vars in ops")
+}
+
+func TestOpsFileErrors(t *testing.T) {
+  _, err := ParseOpsFile("bad.yml", []byte(`
+- type: remove
+  path: /jobs/0
+- type: replace
+  path: /jobs/0/serial
+`))
+  assert.Equal(t, OpsError{File: "bad.yml", Index: 1, Type: "replace", Path: "/jobs/0/serial", Err: errors.New("Missing value")}, err)
+
+  missing, _ := ParseOpsFile("missing.yml", []byte(`
+- type: replace
+  path: /jobs/name=deploy/serial?
+  value: true
+- type: remove
+  path: /jobs/name=unit
+`))
+  _, err = ValidateConfigWithOptions([]byte(baseConfig), ValidateOptions{
+    EvaluateOptions: EvaluateOptions{OpsFiles: []OpsFile{missing}},
+  })
+  assert.True(t, errors.Is(err, ErrInvalidConfig))
+  assert.Contains(t, err.Error(), "ops file missing.yml: operation [1] (remove /jobs/name=unit): ")
+}
+
+func TestSetPipelineWithOpsFiles(t *testing.T) {
+  serial, err := ParseOpsFile("serial.yml", []byte("- type: replace\n  path: /jobs/0/serial?\n  value: true\n"))
+  assert.Nil(t, err)
+
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, nil)
+  team.On("CreateOrUpdatePipelineConfig", "foo", "", mock.MatchedBy(func (configYaml []byte) bool {
+      var config atc.Config
+      err := yaml.Unmarshal(configYaml, &config)
+      return err == nil && config.Jobs[0].Serial
+    }), false).Return(true, false, []concourse.ConfigWarning{}, nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  _, _, _, err = SetPipelineWithOptions(target, "foo", []byte(baseConfig), PipelineOptions{
+    EvaluateOptions: EvaluateOptions{OpsFiles: []OpsFile{serial}},
+  })
+  assert.Nil(t, err)
+  team.AssertExpectations(t)
+}
+
+func TestOpsFilesBeforeInterpolation(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "ops")
+  defer os.RemoveAll(dir)
+  path := writeTempFile(t, dir, "serial.yml", "- type: replace\n  path: /jobs/name=((job))/serial?\n  value: true\n")
+
+  config, err := EvaluateConfigWithOptions([]byte("jobs:\n  - name: ((job))\n"), EvaluateOptions{
+    Sources: []VarSource{StaticVarSource{Vars: map[string]interface{}{"job": "deploy"}}},
+    OpsFiles: []OpsFile{{Path: path}},
+  })
+  assert.Nil(t, err, "Should read ops files given by path")
+  var evaluated atc.Config
+  yaml.Unmarshal(config, &evaluated)
+  assert.True(t, evaluated.Jobs[0].Serial, "Should patch the config as written")
+
+  _, err = EvaluateConfigWithOptions([]byte(baseConfig), EvaluateOptions{
+    OpsFiles: []OpsFile{{Path: filepath.Join(dir, "missing.yml")}},
+  })
+  assert.Contains(t, err.Error(), "could not read ops file ("+filepath.Join(dir, "missing.yml")+")")
+
+  _, err = EvaluateConfigWithOptions([]byte("jobs:\n  - name: {{job}}\n"), EvaluateOptions{
+    Sources: []VarSource{StaticVarSource{Vars: map[string]interface{}{"job": "deploy"}}},
+    OpsFiles: []OpsFile{{Path: path}},
+  })
+  assert.EqualError(t, err, "cannot apply ops files to a config with {{var}} placeholders; migrate them to ((var)) first")
+}
+
+func TestOpsFilesIssueLocations(t *testing.T) {
+  ops, err := ParseOpsFile("ops.yml", []byte(`
+- type: remove
+  path: /jobs/name=lint
+- type: replace
+  path: /jobs/-
+  value: {name: smoke, plan: [get: missing-smoke]}
+`))
+  assert.Nil(t, err)
+
+  _, err = ValidateConfigWithOptions([]byte(`jobs:
+  - name: lint
+    plan: [get: repo]
+  - name: deploy
+    plan: [get: missing-deploy]
+resources:
+  - name: repo
+    type: git
+`), ValidateOptions{
+    EvaluateOptions: EvaluateOptions{OpsFiles: []OpsFile{ops}},
+    ConfigPath: "pipeline.yml",
+  })
+  assert.Equal(t, []ConfigIssue{
+    {
+      Severity: SeverityError,
+      Message: "resource 'repo' is not used",
+      Location: ConfigLocation{"pipeline.yml", 7, 5},
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.deploy.plan[0].get.missing-deploy refers to a resource that does not exist",
+      Location: ConfigLocation{"pipeline.yml", 5, 12},
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.smoke.plan[0].get.missing-smoke refers to a resource that does not exist",
+      Location: ConfigLocation{Path: "pipeline.yml"},
+    },
+  }, err.(BadConfigError).Issues, "Should locate items the ops moved, and not the ones they added")
+}
@@ -1,47 +1,290 @@
 package main
 
 import (
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "reflect"
+  "time"
+
+  yaml "gopkg.in/yaml.v2"
+
   "github.com/concourse/atc"
   "github.com/concourse/go-concourse/concourse"
-	"github.com/ribaptista/concourse-poc/flaghelpers"
   "github.com/concourse/fly/rc"
 )
 
+// PipelineOptions controls how SetPipeline evaluates and uploads a config.
+type PipelineOptions struct {
+  EvaluateOptions
+  // CheckCredentials has the ATC check the config's credentials, so the
+  // config is uploaded even if the pipeline already has it.
+  CheckCredentials bool
+
+  // Strict rejects unknown fields and duplicate keys, and turns warnings
+  // into errors, as in ValidateOptions.
+  Strict bool
+  // Lint runs lint rules before the config is uploaded, as in
+  // ValidateOptions.
+  Lint *LintOptions
+  // Policy is enforced, with the overrides of the target's team, before the
+  // config is uploaded.
+  Policy *Policy
+  // ReadVersion fetches the pipeline's config again after an upload, to fill
+  // SetPipelineResult.Version. The ATC does not return it from the upload.
+  ReadVersion bool
+}
+
+// ErrPipelineUnchanged is returned, with neither created nor updated, when
+// the pipeline already had the same config and was left alone.
+var ErrPipelineUnchanged = errors.New("pipeline unchanged")
+
+// SetPipeline evaluates config and sets it as the pipeline's config. It
+// returns whether the pipeline was created or updated, or
+// ErrPipelineUnchanged if there was nothing to upload.
 func SetPipeline(target rc.Target, name string, config []byte, vars map[string]string, checkCredentials bool) (bool, bool, []concourse.ConfigWarning, error) {
-  _, _, existingConfigVersion, _, err := target.Team().PipelineConfig(name)
+  return SetPipelineWithOptions(target, name, config, PipelineOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{stringMapSource(vars)},
+    },
+    CheckCredentials: checkCredentials,
+  })
+}
+
+// PipelineVars are the library counterpart of fly's -l, -v and -y flags, and
+// follow the same precedence: Vars override Files, and YAMLVars override both.
+// Later files override earlier ones.
+type PipelineVars struct {
+  Files    []string
+  Vars     map[string]string
+  YAMLVars map[string]interface{}
+}
+
+func (v PipelineVars) Sources() []VarSource {
+  sources := []VarSource{}
+  for _, path := range v.Files {
+    sources = append(sources, YAMLFileVarSource{Path: path})
+  }
+  if len(v.Vars) > 0 {
+    sources = append(sources, stringMapSource(v.Vars))
+  }
+  if len(v.YAMLVars) > 0 {
+    sources = append(sources, StaticVarSource{Label: "yaml vars", Vars: v.YAMLVars})
+  }
+  return sources
+}
+
+// SetPipelineWithVars is SetPipeline for structured vars and var files.
+func SetPipelineWithVars(target rc.Target, name string, config []byte, vars PipelineVars, checkCredentials bool) (bool, bool, []concourse.ConfigWarning, error) {
+  return SetPipelineWithOptions(target, name, config, PipelineOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: vars.Sources(),
+    },
+    CheckCredentials: checkCredentials,
+  })
+}
+
+// PipelineStatus is what SetPipelineWithResult did to a pipeline.
+type PipelineStatus string
+
+const (
+  PipelineCreated PipelineStatus = "created"
+  PipelineUpdated PipelineStatus = "updated"
+  // PipelineUnchanged means the pipeline already had the same config, which
+  // was then not uploaded again.
+  PipelineUnchanged PipelineStatus = "unchanged"
+)
+
+// SetPipelineResult describes what a SetPipelineWithResult call did.
+type SetPipelineResult struct {
+  // Status is empty on error, or if the ATC reported neither a creation nor
+  // an update.
+  Status PipelineStatus
+
+  // PreviousVersion is the config version the call started from, empty for
+  // new pipelines. Version is the same for unchanged pipelines; after an
+  // upload it is only set with PipelineOptions.ReadVersion, and is left
+  // empty if reading it back fails, as the upload itself succeeded.
+  PreviousVersion string
+  Version         string
+
+  // Warnings holds the ATC's warnings and local ones, such as lint warnings.
+  Warnings []concourse.ConfigWarning
+  Diff     ConfigDiff
+  // ConfigHash is the hex-encoded SHA-256 of the evaluated config.
+  ConfigHash string
+
+  Durations SetPipelineDurations
+}
+
+// SetPipelineDurations breaks down how long a SetPipelineWithResult call
+// took. Upload is zero for unchanged pipelines.
+type SetPipelineDurations struct {
+  Evaluate time.Duration
+  Validate time.Duration
+  Upload   time.Duration
+  Total    time.Duration
+}
+
+// SetPipelineWithOptions is SetPipelineWithResult with SetPipeline's results.
+// Unchanged pipelines are reported as ErrPipelineUnchanged with the local
+// warnings.
+func SetPipelineWithOptions(target rc.Target, name string, config []byte, options PipelineOptions) (bool, bool, []concourse.ConfigWarning, error) {
+  result, err := SetPipelineWithResult(target, name, config, options)
+  if err != nil {
+    return false, false, nil, err
+  }
+  if result.Status == PipelineUnchanged {
+    return false, false, result.Warnings, ErrPipelineUnchanged
+  }
+  return result.Status == PipelineCreated, result.Status == PipelineUpdated, result.Warnings, nil
+}
+
+// SetPipelineWithResult evaluates config, validates it with the lint rules
+// and policy of options, and only then uploads it. Evaluation failures are
+// returned as EvaluationError, validation failures as BadConfigError with
+// every warning and error attached; both match ErrInvalidConfig. On error,
+// the result holds what was done so far.
+func SetPipelineWithResult(target rc.Target, name string, config []byte, options PipelineOptions) (result SetPipelineResult, err error) {
+  start := time.Now()
+  defer func() {
+    result.Durations.Total = time.Since(start)
+  }()
+
+  existingConfig, _, existingConfigVersion, existing, err := target.Team().PipelineConfig(name)
 	if err != nil {
 		if _, ok := err.(concourse.PipelineConfigError); !ok {
-			return false, false, nil, err
+			return result, newAPIError(target, err)
 		}
 	}
+  result.PreviousVersion = existingConfigVersion
+
+  // Nothing reaches the ATC unless it evaluates and validates locally
+  step := time.Now()
+  report, err := newConfig(config, options.EvaluateOptions, false, options.Strict)
+  result.Durations.Evaluate = time.Since(step)
+  if err != nil {
+    return result, EvaluationError{Err: err}
+  }
+  newConfig := report.Config
+  hash := sha256.Sum256(newConfig)
+  result.ConfigHash = hex.EncodeToString(hash[:])
+
+  validateOptions := ValidateOptions{
+    EvaluateOptions: options.EvaluateOptions,
+    Strict:          options.Strict,
+    Lint:            options.Lint,
+    Policy:          options.Policy,
+  }
+  if options.Policy != nil {
+    validateOptions.Team = target.Team().Name()
+  }
+  step = time.Now()
+  localWarnings, err := validateEvaluatedConfig(config, report, validateOptions)
+  result.Durations.Validate = time.Since(step)
+  if err != nil {
+    return result, err
+  }
 
-  newConfig, err := EvaluateConfig(config,
-      mapToVarPairs(vars),
-      []flaghelpers.YAMLVariablePairFlag{},
-      []atc.PathFlag{})
+  var evaluated atc.Config
+  if err := yaml.Unmarshal(newConfig, &evaluated); err != nil {
+    return result, report.Redactor.RedactError(err)
+  }
+  result.Diff, err = diffConfigs(existingConfig, evaluated, report.Redactor)
+  if err != nil {
+    return result, err
+  }
+
+  // Skip the write, and the audit trail it leaves, when nothing changed and
+  // the ATC has nothing to check
+  if existing && !options.CheckCredentials && sameConfig(existingConfig, evaluated) {
+    result.Status = PipelineUnchanged
+    result.Version = existingConfigVersion
+    result.Warnings = mergeWarnings(nil, localWarnings)
+    return result, nil
+  }
+
+  step = time.Now()
   created, updated, warnings, err := target.Team().CreateOrUpdatePipelineConfig(
 		name,
 		existingConfigVersion,
 		newConfig,
-		checkCredentials)
+		options.CheckCredentials)
+  result.Durations.Upload = time.Since(step)
 	if err != nil {
-		return false, false, nil, err
+		return result, newAPIError(target, err)
 	}
+  if created {
+    result.Status = PipelineCreated
+  } else if updated {
+    result.Status = PipelineUpdated
+  }
+  result.Warnings = mergeWarnings(warnings, localWarnings)
+
+  if options.ReadVersion {
+    if _, _, version, _, err := target.Team().PipelineConfig(name); err == nil {
+      result.Version = version
+    }
+  }
+
+	return result, nil
+}
+
+// mergeWarnings adds the local warnings the ATC did not report itself, such
+// as lint warnings, to the ATC's.
+func mergeWarnings(warnings []concourse.ConfigWarning, localWarnings []atc.Warning) []concourse.ConfigWarning {
+  reported := map[string]bool{}
+  for _, warning := range warnings {
+    reported[warning.Message] = true
+  }
 
-	return created, updated, warnings, nil
+  merged := append([]concourse.ConfigWarning{}, warnings...)
+  for _, warning := range localWarnings {
+    if !reported[warning.Message] {
+      merged = append(merged, concourse.ConfigWarning{Type: warning.Type, Message: warning.Message})
+    }
+  }
+  return merged
 }
 
 func UnpausePipeline(target rc.Target, name string) (bool, error) {
-  return target.Team().UnpausePipeline(name)
+  unpaused, err := target.Team().UnpausePipeline(name)
+  if err != nil {
+    return false, newAPIError(target, err)
+  }
+  return unpaused, nil
+}
+
+// sameConfig reports whether an evaluated config means the same as the
+// config the ATC returned. Both are compared through YAML, which normalizes
+// empty values and the number types of JSON and YAML.
+func sameConfig(existing atc.Config, config atc.Config) bool {
+  existingValue, err := normalizedConfig(existing)
+  if err != nil {
+    return false
+  }
+  value, err := normalizedConfig(config)
+  if err != nil {
+    return false
+  }
+  return reflect.DeepEqual(existingValue, value)
+}
+
+func normalizedConfig(config atc.Config) (interface{}, error) {
+  encoded, err := yaml.Marshal(config)
+  if err != nil {
+    return nil, err
+  }
+
+  var value interface{}
+  err = yaml.Unmarshal(encoded, &value)
+  return value, err
 }
 
-func mapToVarPairs(vars map[string]string) []flaghelpers.VariablePairFlag {
-  pairs := []flaghelpers.VariablePairFlag{}
+func stringMapSource(vars map[string]string) VarSource {
+  source := StaticVarSource{Label: "vars", Vars: map[string]interface{}{}}
   for k, v := range vars {
-    pairs = append(pairs, flaghelpers.VariablePairFlag{
-      Name: k,
-      Value: v,
-    })
+    source.Vars[k] = v
   }
-  return pairs
+  return source
 }
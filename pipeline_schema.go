@@ -0,0 +1,143 @@
+package main
+
+import (
+  "encoding/json"
+  "reflect"
+
+  "github.com/concourse/atc"
+)
+
+const schemaDefinitions = "#/definitions/"
+
+// A whole ((var)) placeholder. JSON Schema patterns are ECMA 262, which has
+// no \pL, so this is slightly stricter than varRefRegex.
+var varSchema = map[string]interface{}{
+  "type":    "string",
+  "pattern": `^\(\(!?[-/.\w]+\)\)$`,
+}
+
+// Scalars a YAML string field accepts: yaml.v2 decodes any scalar into one
+var stringSchema = map[string]interface{}{
+  "type": []string{"string", "number", "boolean"},
+}
+
+// Fields atc cannot do without, by type name
+var requiredFields = map[string][]string{
+  "GroupConfig":      {"name"},
+  "JobConfig":        {"name"},
+  "ResourceConfig":   {"name", "type"},
+  "ResourceType":     {"name", "type"},
+  "ImageResource":    {"type", "source"},
+  "TaskRunConfig":    {"path"},
+  "TaskInputConfig":  {"name"},
+  "TaskOutputConfig": {"name"},
+}
+
+// Types with custom unmarshalers, whose fields do not describe their YAML
+var customSchemas = map[reflect.Type]map[string]interface{}{
+  reflect.TypeOf(atc.VersionConfig{}): {
+    "anyOf": []interface{}{
+      map[string]interface{}{"enum": []string{"latest", "every"}},
+      map[string]interface{}{"type": "object", "additionalProperties": stringSchema},
+    },
+  },
+  reflect.TypeOf(atc.ContainerLimits{}): {
+    "type": "object",
+    "properties": map[string]interface{}{
+      "cpu":    map[string]interface{}{"type": []string{"integer", "string"}},
+      "memory": map[string]interface{}{"type": []string{"integer", "string"}},
+    },
+    "additionalProperties": false,
+  },
+}
+
+// PipelineSchema returns a JSON Schema (draft-07) for pipeline configs,
+// generated from atc.Config. A ((var)) placeholder is accepted anywhere a
+// value is, since it may stand for a value of any type.
+func PipelineSchema() map[string]interface{} {
+  definitions := map[string]interface{}{"var": varSchema}
+  typeSchema(reflect.TypeOf(atc.Config{}), definitions)
+
+  return map[string]interface{}{
+    "$schema":     "http://json-schema.org/draft-07/schema#",
+    "title":       "Concourse pipeline",
+    "$ref":        schemaDefinitions + "Config",
+    "definitions": definitions,
+  }
+}
+
+// PipelineJSONSchema returns PipelineSchema encoded as indented JSON.
+func PipelineJSONSchema() ([]byte, error) {
+  schema, err := json.MarshalIndent(PipelineSchema(), "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  return append(schema, '\n'), nil
+}
+
+// typeSchema describes t, adding the structs it refers to to definitions.
+func typeSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+
+  if custom, found := customSchemas[t]; found {
+    return orVar(custom)
+  }
+
+  switch t.Kind() {
+  case reflect.String:
+    return stringSchema
+  case reflect.Bool:
+    return orVar(map[string]interface{}{"type": "boolean"})
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+    reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    return orVar(map[string]interface{}{"type": "integer"})
+  case reflect.Float32, reflect.Float64:
+    return orVar(map[string]interface{}{"type": "number"})
+  case reflect.Slice, reflect.Array:
+    return orVar(map[string]interface{}{
+      "type":  "array",
+      "items": typeSchema(t.Elem(), definitions),
+    })
+  case reflect.Map:
+    return orVar(map[string]interface{}{
+      "type":                 "object",
+      "additionalProperties": typeSchema(t.Elem(), definitions),
+    })
+  case reflect.Struct:
+    ref := map[string]interface{}{"$ref": schemaDefinitions + t.Name()}
+    if _, found := definitions[t.Name()]; !found {
+      // Reserve the name first, as plans refer to themselves
+      definitions[t.Name()] = nil
+      definitions[t.Name()] = structSchema(t, definitions)
+    }
+    return orVar(ref)
+  default:
+    return map[string]interface{}{}
+  }
+}
+
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+  fields, order := yamlFields(t)
+  properties := map[string]interface{}{}
+  for _, name := range order {
+    properties[name] = typeSchema(fields[name].Type, definitions)
+  }
+
+  schema := map[string]interface{}{
+    "type":                 "object",
+    "properties":           properties,
+    "additionalProperties": false,
+  }
+  if required, found := requiredFields[t.Name()]; found {
+    schema["required"] = required
+  }
+  return schema
+}
+
+func orVar(schema map[string]interface{}) map[string]interface{} {
+  return map[string]interface{}{
+    "anyOf": []interface{}{schema, map[string]interface{}{"$ref": schemaDefinitions + "var"}},
+  }
+}
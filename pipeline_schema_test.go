@@ -0,0 +1,89 @@
+package main
+
+import (
+  "encoding/json"
+  "io/ioutil"
+  "testing"
+  "github.com/xeipuuv/gojsonschema"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+// validatePipeline validates config against PipelineSchema with a draft-07
+// implementation, and returns each failure as "field type".
+func validatePipeline(t *testing.T, config []byte) []string {
+  schemaJSON, err := PipelineJSONSchema()
+  assert.Nil(t, err)
+  loader := gojsonschema.NewSchemaLoader()
+  loader.Draft = gojsonschema.Draft7
+  loader.AutoDetect = false
+  schema, err := loader.Compile(gojsonschema.NewBytesLoader(schemaJSON))
+  assert.Nil(t, err, "Should export a valid draft-07 schema")
+
+  // Go through JSON, as editors do
+  var value interface{}
+  assert.Nil(t, yaml.Unmarshal(config, &value))
+  encoded, err := json.Marshal(jsonValue(value))
+  assert.Nil(t, err)
+
+  result, err := schema.Validate(gojsonschema.NewBytesLoader(encoded))
+  assert.Nil(t, err)
+  failures := []string{}
+  for _, failure := range result.Errors() {
+    // Failed anyOfs are followed by the failures of their closest alternative
+    if failure.Type() == "number_any_of" {
+      continue
+    }
+    failures = append(failures, failure.Field()+" "+failure.Type())
+  }
+  return failures
+}
+
+func TestSamplePipelineMatchesSchema(t *testing.T) {
+  config, err := ioutil.ReadFile("pipeline.yml")
+  assert.Nil(t, err)
+  assert.Empty(t, validatePipeline(t, config))
+}
+
+func TestPipelineSchema(t *testing.T) {
+  assert.Empty(t, validatePipeline(t, []byte(`
+resources:
+  - name: repo
+    type: git
+    source: {uri: ((uri))}
+    check_every: 1m
+jobs:
+  - name: unit
+    serial: ((serial))
+    max_in_flight: 2
+    plan:
+      - get: repo
+        trigger: true
+        version: every
+      - aggregate:
+          - task: test
+            file: repo/test.yml
+            attempts: ((attempts))
+            params: ((params))
+        on_failure:
+          put: repo
+          params: {repository: repo}
+`)), "Should accept vars at any position")
+
+  failures := validatePipeline(t, []byte(`
+jobs:
+  - name: unit
+    serial: maybe
+    plan:
+      - get: repo
+        triger: true
+resources:
+  - name: repo
+`))
+  // A string is closest to the ((var)) alternative, whose pattern it fails
+  assert.ElementsMatch(t, []string{
+    "jobs.0.serial pattern",
+    "jobs.0.plan.0 additional_property_not_allowed",
+    "resources.0 required",
+  }, failures, "Should reject invalid configs")
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+  "encoding/json"
   "errors"
+  "io/ioutil"
+  "os"
   "testing"
   "github.com/concourse/atc"
   "github.com/stretchr/testify/assert"
@@ -85,3 +88,238 @@ func TestConcourseFailure(t *testing.T) {
     false)
   assert.NotNil(t, err, "Should receive error from concourse server")
 }
+
+func TestSetPipelineEvaluationFailure(t *testing.T) {
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(
+      atc.Config{},
+      atc.RawConfig(""),
+      "",
+      false,
+      nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+  _, _, _, err := SetPipeline(target,
+    "foo",
+    []byte(`jobs: [ name: {{jobName}} ]`),
+    map[string]string{},
+    false)
+  assert.NotNil(t, err, "Should not upload configs that fail to evaluate")
+  team.AssertNotCalled(t, "CreateOrUpdatePipelineConfig", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSetPipelineWithYAMLVars(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "vars")
+  defer os.RemoveAll(dir)
+  varFile := writeTempFile(t, dir, "vars.yml", "jobName: fromFile\nargs: [from, file]\n")
+
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(
+      atc.Config{},
+      atc.RawConfig(""),
+      "",
+      false,
+      nil)
+  team.On("CreateOrUpdatePipelineConfig", "foo", "", mock.MatchedBy(func (configYaml []byte) bool {
+      var config atc.Config
+      err := yaml.Unmarshal(configYaml, &config)
+      return err == nil &&
+        config.Jobs[0].Name == "fromVars" &&
+        config.Jobs[0].Plan[0].TaskConfig.Run.Args[1] == "yaml"
+    }), false).Return(
+      true,
+      false,
+      []concourse.ConfigWarning{},
+      nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+  _, _, _, err := SetPipelineWithVars(target,
+    "foo",
+    []byte(`jobs: [ {name: ((jobName)), plan: [{task: t, config: {platform: linux, run: {path: echo, args: ((args))}}}]} ]`),
+    PipelineVars{
+      Files: []string{varFile},
+      Vars: map[string]string{"jobName": "fromVars"},
+      YAMLVars: map[string]interface{}{"args": []interface{}{"from", "yaml"}},
+    },
+    false)
+  assert.Nil(t, err, "Should apply structured vars over var files")
+  team.AssertExpectations(t)
+}
+
+func TestSetUnchangedPipeline(t *testing.T) {
+  config := `
+resources:
+  - name: repo
+    type: git
+    source: {uri: ((uri)), depth: 1}
+jobs:
+  - name: unit
+    plan: [{get: repo, trigger: true}]
+`
+  // As decoded from the ATC's JSON, numbers included
+  var existingConfig atc.Config
+  err := json.Unmarshal([]byte(`{
+    "resources": [{"name": "repo", "type": "git", "source": {"depth": 1, "uri": "git@example.com:repo"}}],
+    "jobs": [{"name": "unit", "public": false, "plan": [{"get": "repo", "trigger": true}]}]
+  }`), &existingConfig)
+  assert.Nil(t, err)
+
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(existingConfig, atc.RawConfig(""), "7", true, nil)
+  team.On("CreateOrUpdatePipelineConfig", "foo", "7", mock.Anything, false).Return(
+      false,
+      true,
+      []concourse.ConfigWarning{},
+      nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  created, updated, _, err := SetPipeline(target, "foo", []byte(config), map[string]string{"uri": "git@example.com:repo"}, false)
+  assert.Equal(t, ErrPipelineUnchanged, err, "Should report an unchanged pipeline")
+  assert.False(t, created || updated)
+  result, err := SetPipelineWithResult(target, "foo", []byte(config), PipelineOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{stringMapSource(map[string]string{"uri": "git@example.com:repo"})},
+    },
+  })
+  assert.Nil(t, err)
+  assert.Equal(t, PipelineUnchanged, result.Status)
+  assert.Equal(t, "7", result.Version)
+  team.AssertNotCalled(t, "CreateOrUpdatePipelineConfig", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+  created, updated, _, err = SetPipeline(target, "foo", []byte(config), map[string]string{"uri": "git@example.com:other"}, false)
+  assert.Nil(t, err)
+  assert.True(t, updated, "Should update a changed pipeline")
+  team.AssertExpectations(t)
+
+  team.On("CreateOrUpdatePipelineConfig", "foo", "7", mock.Anything, true).Return(
+      false,
+      true,
+      []concourse.ConfigWarning{},
+      nil)
+  _, updated, _, err = SetPipeline(target, "foo", []byte(config), map[string]string{"uri": "git@example.com:repo"}, true)
+  assert.Nil(t, err)
+  assert.True(t, updated, "Should upload unchanged configs to check their credentials")
+  team.AssertCalled(t, "CreateOrUpdatePipelineConfig", "foo", "7", mock.Anything, true)
+}
+
+func TestSetPipelineValidatesFirst(t *testing.T) {
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  _, _, _, err := SetPipelineWithOptions(target, "foo", []byte(`jobs: [ {name: ((jobName)), plan: []} ]`), PipelineOptions{
+    EvaluateOptions: EvaluateOptions{ExpectAllVars: true},
+  })
+  var unresolvedErr UnresolvedVarsError
+  assert.True(t, errors.As(err, &unresolvedErr), "Should return evaluation errors")
+  assert.True(t, errors.Is(err, ErrInvalidConfig))
+  assert.Equal(t, "could not evaluate config: unresolved template variables:\n  ((jobName)) at jobs[0].name", err.Error())
+
+  _, _, _, err = SetPipelineWithOptions(target, "foo", []byte(`jobs: [ {name: unit, plan: [get: repo]} ]`), PipelineOptions{})
+  assert.IsType(t, BadConfigError{}, err, "Should return validation errors")
+  assert.Equal(t, []string{"invalid jobs:\n\tjobs.unit.plan[0].get.repo refers to a resource that does not exist\n"}, err.(BadConfigError).Errors)
+
+  config := []byte("resources: [ {name: repo, type: git} ]\njobs: [ {name: unit, public: true, plan: [get: repo]} ]\n")
+  _, _, _, err = SetPipelineWithOptions(target, "foo", config, PipelineOptions{
+    Strict: true,
+    Lint: &LintOptions{},
+  })
+  assert.Equal(t, []atc.Warning{
+    {Type: "lint", Message: "jobs.unit is public, so anyone can read its build logs"},
+  }, err.(BadConfigError).Warnings, "Should fail on warnings in strict mode")
+
+  team.AssertNotCalled(t, "CreateOrUpdatePipelineConfig", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+  team.On("CreateOrUpdatePipelineConfig", "foo", "", mock.Anything, false).Return(
+      true,
+      false,
+      []concourse.ConfigWarning{{Type: "deprecation", Message: "from the ATC"}},
+      nil)
+  _, _, warnings, err := SetPipelineWithOptions(target, "foo", config, PipelineOptions{Lint: &LintOptions{}})
+  assert.Nil(t, err)
+  assert.Equal(t, []concourse.ConfigWarning{
+    {Type: "deprecation", Message: "from the ATC"},
+    {Type: "lint", Message: "jobs.unit is public, so anyone can read its build logs"},
+  }, warnings, "Should add lint warnings to the ATC's")
+}
+
+func TestSetPipelineWithResult(t *testing.T) {
+  var existingConfig atc.Config
+  err := json.Unmarshal([]byte(`{
+    "resources": [{"name": "repo", "type": "git", "source": {"uri": "old"}}, {"name": "tools", "type": "git"}],
+    "jobs": [{"name": "unit", "plan": [{"get": "repo"}, {"get": "tools"}]}]
+  }`), &existingConfig)
+  assert.Nil(t, err)
+
+  config := []byte(`
+resources:
+  - name: repo
+    type: git
+    source: {uri: new}
+jobs:
+  - name: unit
+    plan: [get: repo]
+  - name: ((secretJob))
+    plan: [get: repo]
+`)
+
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(existingConfig, atc.RawConfig(""), "7", true, nil).Once()
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "8", true, nil)
+  team.On("CreateOrUpdatePipelineConfig", "foo", "7", mock.Anything, false).Return(
+      false,
+      true,
+      []concourse.ConfigWarning{},
+      nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  result, err := SetPipelineWithResult(target, "foo", config, PipelineOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{stringMapSource(map[string]string{"secretJob": "hidden-job"})},
+      Sensitive: SensitiveVars{Names: []string{"secret*"}},
+    },
+    ReadVersion: true,
+  })
+  assert.Nil(t, err)
+  assert.Equal(t, PipelineUpdated, result.Status)
+  assert.Equal(t, "7", result.PreviousVersion)
+  assert.Equal(t, "8", result.Version, "Should read the new version back")
+  assert.Len(t, result.ConfigHash, 64)
+  assert.Equal(t, `job '[REDACTED]' added
+job 'unit' changed
+resource 'repo' changed
+resource 'tools' removed`, result.Diff.String(), "Should summarize changes with sensitive names redacted")
+  assert.True(t, result.Durations.Total >= result.Durations.Evaluate+result.Durations.Validate+result.Durations.Upload)
+  team.AssertExpectations(t)
+}
+
+func TestSetPipelineReadVersion(t *testing.T) {
+  config := []byte("jobs: [ {name: unit, plan: []} ]\n")
+
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, nil).Once()
+  team.On("CreateOrUpdatePipelineConfig", "foo", "", mock.Anything, false).Return(
+      true,
+      false,
+      []concourse.ConfigWarning{},
+      nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  result, err := SetPipelineWithResult(target, "foo", config, PipelineOptions{})
+  assert.Nil(t, err)
+  assert.Equal(t, PipelineCreated, result.Status)
+  assert.Empty(t, result.Version, "Should not read the version back by default")
+  team.AssertNumberOfCalls(t, "PipelineConfig", 1)
+
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, nil).Once()
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, errors.New("connection reset")).Once()
+  result, err = SetPipelineWithResult(target, "foo", config, PipelineOptions{ReadVersion: true})
+  assert.Nil(t, err, "Should not fail once the config is uploaded")
+  assert.Equal(t, PipelineCreated, result.Status)
+  assert.Empty(t, result.Version, "Should leave the version empty if it cannot be read back")
+  team.AssertNumberOfCalls(t, "PipelineConfig", 3)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+
+  "github.com/concourse/atc"
+)
+
+const (
+  PolicyResourceTypes   = "policy/resource-types"
+  PolicyRegistries      = "policy/registries"
+  PolicyDeployOnFailure = "policy/deploy-on-failure"
+  PolicyPrivilegedTasks = "policy/privileged-tasks"
+)
+
+// Policy holds organization-wide rules every pipeline must follow, read
+// from a file such as:
+//
+//   allowed_resource_types: [git, time, registry-image, s3]
+//   allowed_registries: [docker.io, registry.example.com]
+//   require_on_failure_for_deploy: true
+//   forbid_privileged_tasks: true
+//   teams:
+//     platform:
+//       forbid_privileged_tasks: false
+//
+// Team entries override the organization's rules they set.
+type Policy struct {
+  Path string `yaml:"-"`
+
+  PolicyRules `yaml:",inline"`
+  Teams       map[string]PolicyRules `yaml:"teams"`
+}
+
+// PolicyRules are the rules of a Policy. An unset or empty list allows
+// anything.
+type PolicyRules struct {
+  AllowedResourceTypes []string `yaml:"allowed_resource_types"`
+  AllowedRegistries    []string `yaml:"allowed_registries"`
+
+  // RequireDeployOnFailure requires an on_failure hook on jobs that deploy,
+  // as recognized by the deploy-not-serial lint rule.
+  RequireDeployOnFailure *bool `yaml:"require_on_failure_for_deploy"`
+  ForbidPrivilegedTasks  *bool `yaml:"forbid_privileged_tasks"`
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+  contents, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, fmt.Errorf("could not read policy (%s): %s", path, err.Error())
+  }
+
+  return ParsePolicy(path, contents)
+}
+
+// ParsePolicy parses a policy. Unknown fields are rejected, so that a
+// misspelled rule is not silently ignored.
+func ParsePolicy(path string, contents []byte) (*Policy, error) {
+  policy := &Policy{}
+  err := yaml.UnmarshalStrict(contents, policy)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse policy (%s): %s", path, err.Error())
+  }
+  policy.Path = path
+
+  return policy, nil
+}
+
+// ForTeam returns the rules that apply to team's pipelines.
+func (policy *Policy) ForTeam(team string) PolicyRules {
+  rules := policy.PolicyRules
+
+  override, found := policy.Teams[team]
+  if !found {
+    return rules
+  }
+  if override.AllowedResourceTypes != nil {
+    rules.AllowedResourceTypes = override.AllowedResourceTypes
+  }
+  if override.AllowedRegistries != nil {
+    rules.AllowedRegistries = override.AllowedRegistries
+  }
+  if override.RequireDeployOnFailure != nil {
+    rules.RequireDeployOnFailure = override.RequireDeployOnFailure
+  }
+  if override.ForbidPrivilegedTasks != nil {
+    rules.ForbidPrivilegedTasks = override.ForbidPrivilegedTasks
+  }
+  return rules
+}
+
+// issues returns every violation of the team's rules as a located error.
+// Unlike lint findings, violations cannot be suppressed from the config.
+func (policy *Policy) issues(team string, config atc.Config, locator *configLocator) []ConfigIssue {
+  rules := policy.ForTeam(team)
+
+  checks := []struct {
+    rule  string
+    check func(atc.Config) []LintFinding
+  }{
+    {PolicyResourceTypes, rules.checkResourceTypes},
+    {PolicyRegistries, rules.checkRegistries},
+    {PolicyDeployOnFailure, rules.checkDeployOnFailure},
+    {PolicyPrivilegedTasks, rules.checkPrivilegedTasks},
+  }
+
+  issues := []ConfigIssue{}
+  for _, check := range checks {
+    for _, finding := range check.check(config) {
+      issues = append(issues, locator.findingIssue(check.rule, SeverityError, finding))
+    }
+  }
+  return issues
+}
+
+func (rules PolicyRules) checkResourceTypes(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  if len(rules.AllowedResourceTypes) == 0 {
+    return findings
+  }
+
+  // Resources may use the pipeline's own resource types, whose types are
+  // checked in turn
+  custom := map[string]bool{}
+  for _, resourceType := range config.ResourceTypes {
+    custom[resourceType.Name] = true
+    if !containsString(rules.AllowedResourceTypes, resourceType.Type) {
+      findings = append(findings, LintFinding{
+        Identifier: "resource_types." + resourceType.Name,
+        Message:    fmt.Sprintf("uses resource type '%s', which is not allowed", resourceType.Type),
+      })
+    }
+  }
+
+  for _, resource := range config.Resources {
+    if !custom[resource.Type] && !containsString(rules.AllowedResourceTypes, resource.Type) {
+      findings = append(findings, LintFinding{
+        Identifier: "resources." + resource.Name,
+        Message:    fmt.Sprintf("uses resource type '%s', which is not allowed", resource.Type),
+      })
+    }
+  }
+
+  return findings
+}
+
+func (rules PolicyRules) checkRegistries(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  if len(rules.AllowedRegistries) == 0 {
+    return findings
+  }
+
+  check := func(identifier string, resourceType string, source atc.Source) {
+    if resourceType != "docker-image" && resourceType != "registry-image" {
+      return
+    }
+    repository, _ := source["repository"].(string)
+    registry := imageRegistry(repository)
+    if !containsString(rules.AllowedRegistries, registry) {
+      findings = append(findings, LintFinding{
+        Identifier: identifier,
+        Message:    fmt.Sprintf("uses image '%s' from registry '%s', which is not allowed", repository, registry),
+      })
+    }
+  }
+
+  for _, resourceType := range config.ResourceTypes {
+    check("resource_types."+resourceType.Name, resourceType.Type, resourceType.Source)
+  }
+  for _, resource := range config.Resources {
+    check("resources."+resource.Name, resource.Type, resource.Source)
+  }
+  for _, job := range config.Jobs {
+    walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+      if step.TaskConfig != nil && step.TaskConfig.ImageResource != nil {
+        image := step.TaskConfig.ImageResource
+        check(identifier, image.Type, image.Source)
+      }
+    })
+  }
+
+  return findings
+}
+
+func (rules PolicyRules) checkDeployOnFailure(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  if rules.RequireDeployOnFailure == nil || !*rules.RequireDeployOnFailure {
+    return findings
+  }
+
+  for _, job := range config.Jobs {
+    if job.Failure == nil && findDeployStep(job) != "" {
+      findings = append(findings, LintFinding{
+        Identifier: "jobs." + job.Name,
+        Message:    "deploys but has no on_failure hook",
+      })
+    }
+  }
+  return findings
+}
+
+func (rules PolicyRules) checkPrivilegedTasks(config atc.Config) []LintFinding {
+  findings := []LintFinding{}
+  if rules.ForbidPrivilegedTasks == nil || !*rules.ForbidPrivilegedTasks {
+    return findings
+  }
+
+  for _, job := range config.Jobs {
+    walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+      if step.Task != "" && step.Privileged {
+        findings = append(findings, LintFinding{
+          Identifier: identifier,
+          Message:    "runs privileged, which is not allowed",
+        })
+      }
+    })
+  }
+  return findings
+}
+
+// imageRegistry returns the registry host of a docker repository, following
+// docker's rule that the first component is a host only if it looks like one.
+func imageRegistry(repository string) string {
+  parts := strings.SplitN(repository, "/", 2)
+  if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+    return parts[0]
+  }
+  return "docker.io"
+}
+
+func containsString(values []string, value string) bool {
+  for _, v := range values {
+    if v == value {
+      return true
+    }
+  }
+  return false
+}
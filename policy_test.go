@@ -0,0 +1,114 @@
+package main
+
+import (
+  "testing"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/ribaptista/concourse-poc/mocks"
+  "github.com/concourse/atc"
+)
+
+const testPolicy = `allowed_resource_types: [git, registry-image]
+allowed_registries: [registry.example.com]
+require_on_failure_for_deploy: true
+forbid_privileged_tasks: true
+teams:
+  platform:
+    forbid_privileged_tasks: false
+    allowed_resource_types: [git, registry-image, cf]
+`
+
+const policyConfig = `jobs:
+  - name: ship
+    plan:
+      - get: repo
+      - task: package
+        privileged: true
+        config:
+          platform: linux
+          image_resource:
+            type: registry-image
+            source: {repository: golang, tag: "1.11"}
+          run: {path: make}
+      - put: deploy
+        params: {file: repo/app}
+resources:
+  - name: repo
+    type: git
+  - name: deploy
+    type: cf
+`
+
+func TestPolicyTeamOverrides(t *testing.T) {
+  policy, err := ParsePolicy("policy.yml", []byte(testPolicy))
+  assert.Nil(t, err)
+
+  rules := policy.ForTeam("platform")
+  assert.Equal(t, []string{"git", "registry-image", "cf"}, rules.AllowedResourceTypes)
+  assert.Equal(t, []string{"registry.example.com"}, rules.AllowedRegistries)
+  assert.False(t, *rules.ForbidPrivilegedTasks)
+  assert.True(t, *rules.RequireDeployOnFailure)
+
+  assert.Equal(t, policy.PolicyRules, policy.ForTeam("main"))
+
+  _, err = ParsePolicy("policy.yml", []byte(`forbid_privileged: true`))
+  assert.Error(t, err, "Should reject unknown rules")
+}
+
+func TestValidateConfigWithPolicy(t *testing.T) {
+  policy, _ := ParsePolicy("policy.yml", []byte(testPolicy))
+
+  _, err := ValidateConfigWithOptions([]byte(policyConfig), ValidateOptions{
+    ConfigPath: "pipeline.yml",
+    Policy: policy,
+    Team: "main",
+  })
+  assert.IsType(t, BadConfigError{}, err)
+  assert.Equal(t, []ConfigIssue{
+    {
+      Severity: SeverityError,
+      Message: "resources.deploy uses resource type 'cf', which is not allowed",
+      Location: ConfigLocation{"pipeline.yml", 18, 5},
+      Rule: PolicyResourceTypes,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.ship.plan[1].task.package uses image 'golang' from registry 'docker.io', which is not allowed",
+      Location: ConfigLocation{"pipeline.yml", 5, 9},
+      Rule: PolicyRegistries,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.ship deploys but has no on_failure hook",
+      Location: ConfigLocation{"pipeline.yml", 2, 5},
+      Rule: PolicyDeployOnFailure,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.ship.plan[1].task.package runs privileged, which is not allowed",
+      Location: ConfigLocation{"pipeline.yml", 5, 9},
+      Rule: PolicyPrivilegedTasks,
+    },
+  }, err.(BadConfigError).Issues, "Should report every policy violation")
+
+  _, err = ValidateConfigWithOptions([]byte(policyConfig), ValidateOptions{
+    Policy: policy,
+    Team: "platform",
+  })
+  assert.Len(t, err.(BadConfigError).Issues, 2, "Should apply team overrides")
+}
+
+func TestSetPipelineWithPolicy(t *testing.T) {
+  policy, _ := ParsePolicy("policy.yml", []byte(testPolicy))
+
+  team := new(mocks.Team)
+  team.On("Name").Return("main")
+  team.On("PipelineConfig", "foo").Return(atc.Config{}, atc.RawConfig(""), "", false, nil)
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+
+  _, _, _, err := SetPipelineWithOptions(target, "foo", []byte(policyConfig), PipelineOptions{Policy: policy})
+  assert.IsType(t, BadConfigError{}, err)
+  assert.Len(t, err.(BadConfigError).Issues, 4)
+  team.AssertNotCalled(t, "CreateOrUpdatePipelineConfig", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+  "fmt"
+  "net/http"
+  "net/url"
+  "strings"
+
+  "golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig routes a target's traffic through an explicit proxy instead of
+// the one named by the HTTP_PROXY/HTTPS_PROXY environment variables.
+// URL may use the http, https or socks5 scheme. NoProxy entries follow the
+// NO_PROXY conventions: host names, domain suffixes, IP addresses and CIDRs.
+type ProxyConfig struct {
+  URL      string
+  Username string
+  Password string
+  NoProxy  []string
+}
+
+func (c ProxyConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+  proxyURL, err := url.Parse(c.URL)
+  if err != nil {
+    return nil, fmt.Errorf("invalid proxy URL: %s", err.Error())
+  }
+
+  switch proxyURL.Scheme {
+  case "http", "https", "socks5":
+  default:
+    return nil, fmt.Errorf("unsupported proxy scheme '%s'", proxyURL.Scheme)
+  }
+
+  if c.Username != "" {
+    proxyURL.User = url.UserPassword(c.Username, c.Password)
+  }
+
+  config := httpproxy.Config{
+    HTTPProxy:  proxyURL.String(),
+    HTTPSProxy: proxyURL.String(),
+    NoProxy:    strings.Join(c.NoProxy, ","),
+  }
+  proxyForURL := config.ProxyFunc()
+
+  return func(req *http.Request) (*url.URL, error) {
+    return proxyForURL(req.URL)
+  }, nil
+}
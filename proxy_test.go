@@ -0,0 +1,150 @@
+package main
+
+import (
+  "encoding/base64"
+  "encoding/binary"
+  "io"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+func newProxiedClient(t *testing.T, proxy ProxyConfig) *http.Client {
+  options, err := newTargetOptions(false, []TargetOption{WithProxy(proxy)})
+  assert.Nil(t, err)
+  return &http.Client{Transport: transport(false, nil, options)}
+}
+
+func TestHTTPProxy(t *testing.T) {
+  proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    credentials := base64.StdEncoding.EncodeToString([]byte("proxyuser:proxypass"))
+    assert.Equal(t, "Basic "+credentials, r.Header.Get("Proxy-Authorization"), "Should authenticate with the proxy")
+    assert.Equal(t, "http://concourse.test/api/v1/info", r.URL.String(), "Should forward absolute URLs")
+    w.Write([]byte("via proxy"))
+  }))
+  defer proxy.Close()
+
+  client := newProxiedClient(t, ProxyConfig{
+    URL: proxy.URL,
+    Username: "proxyuser",
+    Password: "proxypass",
+  })
+  resp, err := client.Get("http://concourse.test/api/v1/info")
+  assert.Nil(t, err)
+  body, _ := ioutil.ReadAll(resp.Body)
+  resp.Body.Close()
+  assert.Equal(t, "via proxy", string(body))
+}
+
+func TestNoProxy(t *testing.T) {
+  proxyFunc, err := ProxyConfig{
+    URL: "http://proxy.test:3128",
+    NoProxy: []string{".internal.test", "10.0.0.0/8"},
+  }.proxyFunc()
+  assert.Nil(t, err)
+
+  for rawURL, proxied := range map[string]bool{
+    "http://ci.internal.test/api/v1/info": false,
+    "http://10.1.2.3:8080/api/v1/info": false,
+    "https://concourse.test/api/v1/info": true,
+  } {
+    req, _ := http.NewRequest("GET", rawURL, nil)
+    proxyURL, err := proxyFunc(req)
+    assert.Nil(t, err)
+    assert.Equal(t, proxied, proxyURL != nil, "Unexpected proxy decision for %s", rawURL)
+  }
+}
+
+func TestUnsupportedProxyScheme(t *testing.T) {
+  _, err := newTargetOptions(false, []TargetOption{WithProxy(ProxyConfig{URL: "ftp://proxy.test"})})
+  assert.NotNil(t, err, "Should reject unsupported proxy schemes")
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte("via socks"))
+  }))
+  defer server.Close()
+
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  assert.Nil(t, err)
+  defer listener.Close()
+  go serveSOCKS5(t, listener, server.Listener.Addr().String())
+
+  client := newProxiedClient(t, ProxyConfig{
+    URL: "socks5://" + listener.Addr().String(),
+    Username: "proxyuser",
+    Password: "proxypass",
+  })
+  resp, err := client.Get("http://concourse.test/api/v1/info")
+  assert.Nil(t, err)
+  body, _ := ioutil.ReadAll(resp.Body)
+  resp.Body.Close()
+  assert.Equal(t, "via socks", string(body))
+}
+
+// serveSOCKS5 is a minimal RFC 1928 stand-in that only supports
+// username/password authentication and CONNECT, and sends every connection
+// to backend.
+func serveSOCKS5(t *testing.T, listener net.Listener, backend string) {
+  for {
+    conn, err := listener.Accept()
+    if err != nil {
+      return
+    }
+
+    go func() {
+      defer conn.Close()
+
+      header := make([]byte, 2)
+      io.ReadFull(conn, header)
+      methods := make([]byte, header[1])
+      io.ReadFull(conn, methods)
+      conn.Write([]byte{5, 2})
+
+      version := make([]byte, 2)
+      io.ReadFull(conn, version)
+      user := make([]byte, version[1])
+      io.ReadFull(conn, user)
+      passwordLength := make([]byte, 1)
+      io.ReadFull(conn, passwordLength)
+      password := make([]byte, passwordLength[0])
+      io.ReadFull(conn, password)
+      if string(user) != "proxyuser" || string(password) != "proxypass" {
+        t.Errorf("Unexpected SOCKS credentials %s:%s", user, password)
+        conn.Write([]byte{1, 1})
+        return
+      }
+      conn.Write([]byte{1, 0})
+
+      request := make([]byte, 4)
+      io.ReadFull(conn, request)
+      switch request[3] {
+      case 1:
+        io.ReadFull(conn, make([]byte, 4))
+      case 3:
+        hostLength := make([]byte, 1)
+        io.ReadFull(conn, hostLength)
+        io.ReadFull(conn, make([]byte, hostLength[0]))
+      case 4:
+        io.ReadFull(conn, make([]byte, 16))
+      }
+      var port uint16
+      binary.Read(conn, binary.BigEndian, &port)
+
+      upstream, err := net.Dial("tcp", backend)
+      if err != nil {
+        conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+        return
+      }
+      defer upstream.Close()
+      conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+      go io.Copy(upstream, conn)
+      io.Copy(conn, upstream)
+    }()
+  }
+}
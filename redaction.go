@@ -0,0 +1,241 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "sort"
+  "strings"
+  "sync"
+
+  yaml "gopkg.in/yaml.v2"
+
+  "github.com/concourse/atc"
+)
+
+// Values shorter than this are only redacted where they stand alone, as
+// they would otherwise mask parts of unrelated words and numbers.
+const minRedactedLength = 4
+
+// SensitiveVars marks variables whose values must not be rendered by this
+// client. Names are path.Match patterns, such as "*password*"; Sources are
+// VarSource names, such as a secrets var file path, whose variables are all
+// sensitive.
+type SensitiveVars struct {
+  Names   []string
+  Sources []string
+}
+
+func (s SensitiveVars) covers(name string, source string) (bool, error) {
+  for _, sensitiveSource := range s.Sources {
+    if sensitiveSource == source {
+      return true, nil
+    }
+  }
+  return matchesVarPattern(name, s.Names)
+}
+
+// Redactor masks sensitive variable values in text rendered by this client:
+// diffs, trace records, validation errors and rendered configs. The config
+// sent to the ATC is never redacted. A Redactor is safe for concurrent use and
+// can be shared with a target through WithRedactor, so that values found
+// while evaluating a config are also masked in its trace records.
+type Redactor struct {
+  lock   sync.RWMutex
+  values map[string]bool
+  sorted []string
+}
+
+func NewRedactor() *Redactor {
+  return &Redactor{values: map[string]bool{}}
+}
+
+// Add registers a value, and every scalar nested in it, as sensitive.
+func (r *Redactor) Add(value interface{}) {
+  r.lock.Lock()
+  defer r.lock.Unlock()
+  r.add(value)
+
+  r.sorted = make([]string, 0, len(r.values))
+  for v := range r.values {
+    r.sorted = append(r.sorted, v)
+  }
+  // Longest first, so that a value containing another is masked whole
+  sort.Slice(r.sorted, func(i, j int) bool {
+    if len(r.sorted[i]) != len(r.sorted[j]) {
+      return len(r.sorted[i]) > len(r.sorted[j])
+    }
+    return r.sorted[i] < r.sorted[j]
+  })
+}
+
+func (r *Redactor) add(value interface{}) {
+  switch typed := value.(type) {
+  case map[interface{}]interface{}:
+    for _, v := range typed {
+      r.add(v)
+    }
+  case map[string]interface{}:
+    for _, v := range typed {
+      r.add(v)
+    }
+  case []interface{}:
+    for _, v := range typed {
+      r.add(v)
+    }
+  case nil:
+  default:
+    text := fmt.Sprintf("%v", typed)
+    if text == "" {
+      return
+    }
+    r.values[text] = true
+
+    // Rendered configs escape special characters
+    escaped, _ := json.Marshal(text)
+    r.values[strings.Trim(string(escaped), `"`)] = true
+    for _, line := range strings.Split(text, "\n") {
+      if line != "" {
+        r.values[line] = true
+      }
+    }
+  }
+}
+
+// Redact replaces every sensitive value in text with [REDACTED].
+func (r *Redactor) Redact(text string) string {
+  if r == nil {
+    return text
+  }
+
+  r.lock.RLock()
+  defer r.lock.RUnlock()
+  for _, value := range r.sorted {
+    if len(value) < minRedactedLength {
+      text = replaceStandalone(text, value)
+    } else {
+      text = strings.Replace(text, value, redacted, -1)
+    }
+  }
+  return text
+}
+
+// replaceStandalone redacts the occurrences of value that are not part of
+// a longer word or number.
+func replaceStandalone(text string, value string) string {
+  var builder strings.Builder
+  for {
+    i := strings.Index(text, value)
+    if i < 0 {
+      builder.WriteString(text)
+      return builder.String()
+    }
+
+    end := i + len(value)
+    if (i > 0 && isWordByte(text[i-1])) || (end < len(text) && isWordByte(text[end])) {
+      builder.WriteString(text[:i+1])
+      text = text[i+1:]
+      continue
+    }
+    builder.WriteString(text[:i])
+    builder.WriteString(redacted)
+    text = text[end:]
+  }
+}
+
+func isWordByte(b byte) bool {
+  return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func (r *Redactor) RedactBytes(text []byte) []byte {
+  if r == nil {
+    return text
+  }
+  return []byte(r.Redact(string(text)))
+}
+
+// RedactError returns err with sensitive values removed from its message.
+// yaml.TypeErrors, BadConfigErrors, OpsErrors and VarSchemaErrors keep their
+// type, other errors are replaced when their message changes.
+func (r *Redactor) RedactError(err error) error {
+  if r == nil || err == nil {
+    return err
+  }
+
+  switch typedErr := err.(type) {
+  case *yaml.TypeError:
+    redactedErr := &yaml.TypeError{Errors: make([]string, len(typedErr.Errors))}
+    for i, message := range typedErr.Errors {
+      redactedErr.Errors[i] = r.Redact(message)
+    }
+    return redactedErr
+  case BadConfigError:
+    return r.redactBadConfig(typedErr)
+  case OpsError:
+    typedErr.Err = r.RedactError(typedErr.Err)
+    return typedErr
+  case VarSchemaError:
+    redactedErr := VarSchemaError{Violations: make([]VarSchemaViolation, len(typedErr.Violations))}
+    for i, violation := range typedErr.Violations {
+      redactedErr.Violations[i] = violation
+      redactedErr.Violations[i].Message = r.Redact(violation.Message)
+    }
+    return redactedErr
+  }
+
+  message := err.Error()
+  if redactedMessage := r.Redact(message); redactedMessage != message {
+    return errors.New(redactedMessage)
+  }
+  return err
+}
+
+func (r *Redactor) redactBadConfig(err BadConfigError) BadConfigError {
+  redactedErr := err
+  redactedErr.Warnings = r.redactWarnings(err.Warnings)
+  redactedErr.Errors = make([]string, len(err.Errors))
+  for i, message := range err.Errors {
+    redactedErr.Errors[i] = r.Redact(message)
+  }
+  redactedErr.Issues = make([]ConfigIssue, len(err.Issues))
+  for i, issue := range err.Issues {
+    redactedErr.Issues[i] = issue
+    redactedErr.Issues[i].Message = r.Redact(issue.Message)
+  }
+  return redactedErr
+}
+
+func (r *Redactor) redactWarnings(warnings []atc.Warning) []atc.Warning {
+  if warnings == nil {
+    return nil
+  }
+  redactedWarnings := make([]atc.Warning, len(warnings))
+  for i, warning := range warnings {
+    redactedWarnings[i] = warning
+    redactedWarnings[i].Message = r.Redact(warning.Message)
+  }
+  return redactedWarnings
+}
+
+// sensitiveRedactor builds a Redactor holding the values of every sensitive
+// variable, shadowed ones included, on top of base if given.
+func sensitiveRedactor(sources []loadedVarSource, sensitive SensitiveVars, base *Redactor) (*Redactor, error) {
+  redactor := base
+  if redactor == nil {
+    redactor = NewRedactor()
+  }
+
+  for _, source := range sources {
+    for _, name := range sortedVarNames(source.vars) {
+      covered, err := sensitive.covers(name, source.name)
+      if err != nil {
+        return nil, err
+      }
+      if covered {
+        redactor.Add(source.vars[name])
+      }
+    }
+  }
+
+  return redactor, nil
+}
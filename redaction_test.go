@@ -0,0 +1,92 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+func TestRedactValidationErrors(t *testing.T) {
+  _, err := ValidateConfigWithOptions([]byte(`jobs:
+  - name: foo
+    serial: ((db_password))`), ValidateOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{
+        StaticVarSource{Vars: map[string]interface{}{"db_password": "hunter2!"}},
+      },
+      Sensitive: SensitiveVars{Names: []string{"*password*"}},
+    },
+  })
+  assert.IsType(t, &yaml.TypeError{}, err, "Should keep the error type")
+  assert.NotContains(t, err.Error(), "hunter2!", "Should redact sensitive values")
+  assert.Contains(t, err.Error(), redacted)
+}
+
+func TestRedactSchemaViolations(t *testing.T) {
+  schema, err := ParseVarSchema("s.yml", []byte("vars:\n  db_password:\n    type: int\n"))
+  assert.Nil(t, err)
+
+  options := EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{"db_password": "hunter2!"}},
+    },
+    Sensitive: SensitiveVars{Names: []string{"*password*"}},
+    Schema: schema,
+  }
+  _, err = EvaluateConfigWithReport([]byte(`jobs: []`), options)
+  assert.IsType(t, VarSchemaError{}, err, "Should keep the error type")
+  assert.Equal(t, "template variables do not match their schema:\n  s.yml:2:3: ((db_password)) must be an int, got '[REDACTED]'", err.Error())
+
+  options.Schema = nil
+  _, err = EvaluateConfigWithReport([]byte(`jobs: ((db_password))`), options)
+  assert.IsType(t, &yaml.TypeError{}, err)
+  assert.NotContains(t, err.Error(), "hunter2!", "Should redact errors from decoding the evaluated config")
+}
+
+func TestSensitiveVarsKeepPayload(t *testing.T) {
+  report, err := EvaluateConfigWithReport([]byte(`jobs:
+  - name: foo
+    plan: [{task: t, params: {TOKEN: ((token)), USER: ((user))}}]`), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Label: "secrets.yml", Vars: map[string]interface{}{"token": "s3cr3t-token"}},
+      StaticVarSource{Vars: map[string]interface{}{"user": "deployer"}},
+    },
+    Sensitive: SensitiveVars{Sources: []string{"secrets.yml"}},
+    ShowVarValues: true,
+  })
+  assert.Nil(t, err)
+  assert.Contains(t, string(report.Config), "s3cr3t-token", "Should not redact the payload")
+  assert.NotContains(t, string(report.Redactor.RedactBytes(report.Config)), "s3cr3t-token")
+  assert.Equal(t, redacted, report.Provenance[0].Value, "Should redact sensitive provenance")
+  assert.Equal(t, "deployer", report.Provenance[1].Value, "Should show other values on request")
+}
+
+func TestRedactTraceRecords(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+  defer server.Close()
+
+  redactor := NewRedactor()
+  redactor.Add("secret-pipeline")
+  var records []TraceRecord
+  client := &http.Client{Transport: &TracingTransport{
+    Base: http.DefaultTransport,
+    Logger: TraceLoggerFunc(func(record TraceRecord) {
+      records = append(records, record)
+    }),
+    Redactor: redactor,
+  }}
+  resp, err := client.Get(server.URL + "/api/v1/teams/main/pipelines/secret-pipeline/config")
+  assert.Nil(t, err)
+  resp.Body.Close()
+
+  assert.Len(t, records, 1)
+  assert.NotContains(t, records[0].URL, "secret-pipeline", "Should redact sensitive values in trace records")
+}
+
+func TestRedactShortValues(t *testing.T) {
+  redactor := NewRedactor()
+  redactor.Add(map[string]interface{}{"pin": 42, "empty": ""})
+  assert.Equal(t, "pin: [REDACTED], port 4242, jobs[0]", redactor.Redact("pin: 42, port 4242, jobs[0]"), "Should redact short values where they stand alone")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "regexp"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+  yamlv3 "gopkg.in/yaml.v3"
+
+  temp "github.com/concourse/fly/template"
+)
+
+type RenderFormat string
+
+const (
+  RenderYAML RenderFormat = "yaml"
+  RenderJSON RenderFormat = "json"
+)
+
+// A value made of a single ((var)), as in bosh-cli's interpolation
+var wholeVarRefRegex = regexp.MustCompile(`^` + varRefRegex.String() + `$`)
+
+// RenderOptions controls how RenderConfig evaluates and writes a config.
+type RenderOptions struct {
+  EvaluateOptions
+
+  // Format defaults to RenderYAML.
+  Format RenderFormat
+
+  // ExpandAnchors replaces YAML aliases with the nodes they refer to and
+  // applies << merge keys, as the ATC sees them. It is implied by JSON
+  // output and by OpsFiles.
+  ExpandAnchors bool
+
+  // InlineDefaults substitutes the defaults of the var schema. Without it,
+  // variables only set by a default are left as ((var)) placeholders.
+  InlineDefaults bool
+
+  // KeepServerSideVars leaves the ServerSideVars as ((var)) placeholders,
+  // even when a source sets them.
+  KeepServerSideVars bool
+}
+
+// RenderConfig evaluates a config like EvaluateConfigWithOptions and returns
+// it for review. Sensitive values are redacted, so the result must not be
+// sent to the ATC.
+func RenderConfig(configContents []byte, options RenderOptions) ([]byte, error) {
+  evaluateOptions := options.EvaluateOptions
+  evaluateOptions.skipSchemaDefaults = !options.InlineDefaults
+  evaluateOptions.keepServerSideVars = options.KeepServerSideVars
+
+  report, err := EvaluateConfigWithReport(configContents, evaluateOptions)
+  if err != nil {
+    return nil, err
+  }
+
+  var rendered []byte
+  switch options.Format {
+  case RenderYAML, "":
+    rendered = report.Config
+    if !options.ExpandAnchors && len(options.OpsFiles) == 0 {
+      rendered, err = renderPreservingAnchors(configContents, report.sources)
+    }
+  case RenderJSON:
+    rendered, err = renderJSON(report.Config)
+  default:
+    return nil, fmt.Errorf("unknown render format '%s'", options.Format)
+  }
+  if err != nil {
+    return nil, report.Redactor.RedactError(err)
+  }
+
+  return report.Redactor.RedactBytes(rendered), nil
+}
+
+// WriteRenderedConfig renders a config to path, or to stdout if path is ""
+// or "-".
+func WriteRenderedConfig(configContents []byte, options RenderOptions, path string) error {
+  rendered, err := RenderConfig(configContents, options)
+  if err != nil {
+    return err
+  }
+
+  if path == "" || path == "-" {
+    _, err = os.Stdout.Write(rendered)
+    return err
+  }
+  return ioutil.WriteFile(path, rendered, 0644)
+}
+
+// renderPreservingAnchors substitutes the variables of sources in the YAML
+// nodes of a config, so that anchors, aliases, merge keys and comments are
+// kept. The config was already evaluated once, so lookups cannot fail.
+func renderPreservingAnchors(configContents []byte, sources []loadedVarSource) ([]byte, error) {
+  var err error
+  if temp.Present(configContents) {
+    configContents, err = resolveDeprecatedTemplateStyle(configContents, sources, false)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  var document yamlv3.Node
+  err = yamlv3.Unmarshal(configContents, &document)
+  if err != nil {
+    return nil, err
+  }
+  if len(document.Content) == 0 {
+    return configContents, nil
+  }
+
+  err = interpolateNode(&document, sources)
+  if err != nil {
+    return nil, err
+  }
+
+  return encodeYAMLNode(&document)
+}
+
+func interpolateNode(node *yamlv3.Node, sources []loadedVarSource) error {
+  if node.Kind != yamlv3.ScalarNode {
+    for _, child := range node.Content {
+      if err := interpolateNode(child, sources); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+
+  if match := wholeVarRefRegex.FindStringSubmatch(node.Value); match != nil {
+    value, found := lookupVar(match[1], sources)
+    if !found {
+      return nil
+    }
+
+    // Keep the type of the value, and what decorates the node
+    var replacement yamlv3.Node
+    if err := replacement.Encode(value); err != nil {
+      return err
+    }
+    replacement.Anchor = node.Anchor
+    replacement.HeadComment = node.HeadComment
+    replacement.LineComment = node.LineComment
+    replacement.FootComment = node.FootComment
+    *node = replacement
+    return nil
+  }
+
+  node.Value = varRefRegex.ReplaceAllStringFunc(node.Value, func(ref string) string {
+    value, found := lookupVar(varRefRegex.FindStringSubmatch(ref)[1], sources)
+    if !found {
+      return ref
+    }
+    return fmt.Sprintf("%v", value)
+  })
+  return nil
+}
+
+// lookupVar finds a variable like bosh-cli does: ((repo.uri)) reads the uri
+// key of the highest precedence repo variable.
+func lookupVar(name string, sources []loadedVarSource) (interface{}, bool) {
+  path := strings.Split(strings.TrimPrefix(name, "!"), ".")
+
+  value, found := effectiveValue(path[0], sources)
+  for _, key := range path[1:] {
+    if !found {
+      break
+    }
+    switch typed := value.(type) {
+    case map[interface{}]interface{}:
+      value, found = typed[key]
+    case map[string]interface{}:
+      value, found = typed[key]
+    default:
+      found = false
+    }
+  }
+  return value, found
+}
+
+func renderJSON(config []byte) ([]byte, error) {
+  var value interface{}
+  err := yaml.Unmarshal(config, &value)
+  if err != nil {
+    return nil, err
+  }
+
+  rendered, err := json.MarshalIndent(jsonValue(value), "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  return append(rendered, '\n'), nil
+}
+
+// jsonValue converts the map[interface{}]interface{} maps of yaml.v2 into
+// maps encoding/json accepts.
+func jsonValue(value interface{}) interface{} {
+  switch typed := value.(type) {
+  case map[interface{}]interface{}:
+    converted := map[string]interface{}{}
+    for k, v := range typed {
+      converted[fmt.Sprintf("%v", k)] = jsonValue(v)
+    }
+    return converted
+  case []interface{}:
+    converted := make([]interface{}, len(typed))
+    for i, v := range typed {
+      converted[i] = jsonValue(v)
+    }
+    return converted
+  default:
+    return value
+  }
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+const renderedConfig = `resource_defaults: &git
+  type: git
+  source:
+    uri: ((repo_uri))
+    private_key: ((private_key))
+resources:
+  - <<: *git
+    name: repo
+    icon: ((icon))
+jobs:
+  - name: deploy
+    max_in_flight: ((parallelism))
+    plan:
+      - get: repo
+      - put: release
+        params: {token: ((vault-token))}
+`
+
+func renderOptions() RenderOptions {
+  schema, _ := ParseVarSchema("schema.yml", []byte("vars:\n  icon:\n    default: github\n  parallelism:\n    type: int\n"))
+  return RenderOptions{
+    EvaluateOptions: EvaluateOptions{
+      Sources: []VarSource{StaticVarSource{Vars: map[string]interface{}{
+        "repo_uri": "git@example.com:app",
+        "private_key": "-----BEGIN KEY-----",
+        "parallelism": 2,
+        "vault-token": "provided",
+      }}},
+      Schema: schema,
+      ServerSideVars: []string{"vault-*"},
+      Sensitive: SensitiveVars{Names: []string{"private_key"}},
+    },
+  }
+}
+
+func TestRenderConfig(t *testing.T) {
+  rendered, err := RenderConfig([]byte(renderedConfig), renderOptions())
+  assert.Nil(t, err)
+  assert.Equal(t, `resource_defaults: &git
+  type: git
+  source:
+    uri: git@example.com:app
+    private_key: '[REDACTED]'
+resources:
+  - <<: *git
+    name: repo
+    icon: ((icon))
+jobs:
+  - name: deploy
+    max_in_flight: 2
+    plan:
+      - get: repo
+      - put: release
+        params: {token: provided}
+`, string(rendered), "Should keep anchors and placeholders without defaults")
+
+  options := renderOptions()
+  options.ExpandAnchors = true
+  options.InlineDefaults = true
+  options.KeepServerSideVars = true
+  rendered, err = RenderConfig([]byte(renderedConfig), options)
+  assert.Nil(t, err)
+  assert.Equal(t, `jobs:
+- max_in_flight: 2
+  name: deploy
+  plan:
+  - get: repo
+  - params:
+      token: ((vault-token))
+    put: release
+resource_defaults:
+  source:
+    private_key: '[REDACTED]'
+    uri: git@example.com:app
+  type: git
+resources:
+- icon: github
+  name: repo
+  source:
+    private_key: '[REDACTED]'
+    uri: git@example.com:app
+  type: git
+`, string(rendered), "Should expand anchors, inline defaults and keep server-side vars")
+}
+
+func TestRenderConfigJSON(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "render")
+  defer os.RemoveAll(dir)
+  path := dir + "/pipeline.json"
+
+  options := renderOptions()
+  options.Format = RenderJSON
+  err := WriteRenderedConfig([]byte("jobs:\n  - name: deploy\n    max_in_flight: ((parallelism))\n"), options, path)
+  assert.Nil(t, err)
+
+  rendered, _ := ioutil.ReadFile(path)
+  assert.Equal(t, `{
+  "jobs": [
+    {
+      "max_in_flight": 2,
+      "name": "deploy"
+    }
+  ]
+}
+`, string(rendered))
+}
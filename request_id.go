@@ -0,0 +1,107 @@
+package main
+
+import (
+  "crypto/rand"
+  "fmt"
+  "net/http"
+  "sync"
+)
+
+const (
+  ClientName    = "concourse-client"
+  ClientVersion = "0.1.0"
+
+  RequestIDHeader = "X-Request-Id"
+)
+
+func userAgent(appName string) string {
+  agent := fmt.Sprintf("%s/%s", ClientName, ClientVersion)
+  if appName != "" {
+    agent = appName + " " + agent
+  }
+  return agent
+}
+
+// requestTracker remembers the last request a target sent and the status it
+// got back, so that API errors can be matched with ATC logs and classified.
+// Since go-concourse gives no access to the request behind an error,
+// concurrent calls on the same target may report each other's request.
+type requestTracker struct {
+  lock           sync.Mutex
+  lastRequestID  string
+  lastStatusCode int
+}
+
+func (t *requestTracker) record(requestID string) {
+  t.lock.Lock()
+  defer t.lock.Unlock()
+  t.lastRequestID = requestID
+  t.lastStatusCode = 0
+}
+
+func (t *requestTracker) recordStatus(requestID string, statusCode int) {
+  t.lock.Lock()
+  defer t.lock.Unlock()
+  if t.lastRequestID == requestID {
+    t.lastStatusCode = statusCode
+  }
+}
+
+func (t *requestTracker) LastRequestID() string {
+  t.lock.Lock()
+  defer t.lock.Unlock()
+  return t.lastRequestID
+}
+
+func (t *requestTracker) LastStatusCode() int {
+  t.lock.Lock()
+  defer t.lock.Unlock()
+  return t.lastStatusCode
+}
+
+// RequestIDTransport tags every request with a User-Agent and a generated
+// X-Request-Id, unless the caller already set one.
+type RequestIDTransport struct {
+  Base      http.RoundTripper
+  UserAgent string
+  tracker   *requestTracker
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  req = req.Clone(req.Context())
+  if t.UserAgent != "" {
+    req.Header.Set("User-Agent", t.UserAgent)
+  }
+
+  requestID := req.Header.Get(RequestIDHeader)
+  if requestID == "" {
+    var err error
+    requestID, err = newRequestID()
+    if err != nil {
+      return nil, err
+    }
+    req.Header.Set(RequestIDHeader, requestID)
+  }
+
+  if t.tracker != nil {
+    t.tracker.record(requestID)
+  }
+
+  resp, err := t.Base.RoundTrip(req)
+  if err == nil && t.tracker != nil {
+    t.tracker.recordStatus(requestID, resp.StatusCode)
+  }
+
+  return resp, err
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() (string, error) {
+  b := make([]byte, 16)
+  if _, err := rand.Read(b); err != nil {
+    return "", err
+  }
+  b[6] = (b[6] & 0x0f) | 0x40
+  b[8] = (b[8] & 0x3f) | 0x80
+  return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/mock"
+  "github.com/ribaptista/concourse-poc/mocks"
+  "github.com/concourse/go-concourse/concourse"
+)
+
+func TestRequestIDAndUserAgent(t *testing.T) {
+  var requestID, agent string
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    requestID = r.Header.Get(RequestIDHeader)
+    agent = r.Header.Get("User-Agent")
+  }))
+  defer server.Close()
+
+  options, err := newTargetOptions(false, []TargetOption{WithUserAgent("deployer/1.2")})
+  assert.Nil(t, err)
+  client := &http.Client{Transport: transport(false, nil, options)}
+  resp, err := client.Get(server.URL)
+  assert.Nil(t, err)
+  resp.Body.Close()
+
+  assert.Len(t, requestID, 36, "Should send a generated request id")
+  assert.Equal(t, requestID, options.requests.LastRequestID(), "Should remember the last request id")
+  assert.Equal(t, "deployer/1.2 concourse-client/"+ClientVersion, agent, "Should identify the caller")
+}
+
+type trackedTarget struct {
+  *mocks.Target
+}
+
+func (t trackedTarget) LastRequestID() string {
+  return "1234"
+}
+
+func (t trackedTarget) LastStatusCode() int {
+  return 500
+}
+
+func TestSetPipelineErrorCarriesRequestID(t *testing.T) {
+  team := new(mocks.Team)
+  team.On("PipelineConfig", "foo").Return(
+      atc.Config{},
+      atc.RawConfig(""),
+      "",
+      false,
+      nil)
+  team.On("CreateOrUpdatePipelineConfig", "foo", "", mock.Anything, false).Return(
+      false,
+      false,
+      []concourse.ConfigWarning{},
+      errors.New("Server failure"))
+  target := new(mocks.Target)
+  target.On("Team").Return(team)
+  _, _, _, err := SetPipeline(trackedTarget{target},
+    "foo",
+    []byte(``),
+    map[string]string{},
+    false)
+  var apiErr APIError
+  assert.True(t, errors.As(err, &apiErr), "Should return an API error")
+  assert.Equal(t, "1234", apiErr.RequestID)
+  assert.Contains(t, err.Error(), "request id: 1234")
+}
@@ -50,6 +50,7 @@ type target struct {
 	url       string
 	token     *rc.TargetToken
 	info      atc.Info
+	requests  *requestTracker
 }
 
 func newTarget(
@@ -89,21 +90,27 @@ func NewAuthenticatedTarget(
 	tracing bool,
 	clientFactory ClientFactory,
 	authenticator Authenticator,
+	options ...TargetOption,
 ) (rc.Target, error) {
 	caCertPool, err := loadCACertPool(caCert)
 	if err != nil {
 		return nil, err
 	}
 
+	targetOptions, err := newTargetOptions(tracing, options)
+	if err != nil {
+		return nil, err
+	}
+
 	token, err := authenticate(url, username, password, caCertPool,
-			insecure, tracing, clientFactory, authenticator)
+			insecure, targetOptions, clientFactory, authenticator)
 	if err != nil {
 		return nil, err
 	}
 
-  httpClient := defaultHttpClient(token, insecure, caCertPool)
-	client := clientFactory.NewClient(url, httpClient, tracing)
-	return newTarget(
+  httpClient := defaultHttpClient(token, insecure, caCertPool, targetOptions)
+	client := clientFactory.NewClient(url, httpClient, false)
+	target := newTarget(
 		name,
 		teamName,
 		url,
@@ -112,7 +119,9 @@ func NewAuthenticatedTarget(
 		caCertPool,
 		insecure,
 		client,
-	), nil
+	)
+	target.requests = targetOptions.requests
+	return target, nil
 }
 
 func authenticate(
@@ -121,14 +130,21 @@ func authenticate(
 		password string,
 		caCertPool *x509.CertPool,
 		insecure bool,
-		tracing bool,
+		options *targetOptions,
 		clientFactory ClientFactory,
 		authenticator Authenticator) (*rc.TargetToken, error) {
-	httpClient := &http.Client{Transport: transport(insecure, caCertPool)}
-	client := clientFactory.NewClient(url, httpClient, tracing)
+	httpClient := &http.Client{Transport: transport(insecure, caCertPool, options)}
+	client := clientFactory.NewClient(url, httpClient, false)
 	token, err := authenticator.GetToken(client, username, password)
   if err != nil {
-    return nil, errors.New(fmt.Sprintf("Failed to authenticate: %s", err.Error()))
+    err = wrapAPIError(options.requests, fmt.Errorf("Failed to authenticate: %w", err))
+    var authErr APIError
+    if errors.As(err, &authErr) && authErr.StatusCode == http.StatusBadRequest {
+      // The token endpoint answers bad credentials with invalid_grant
+      authErr.Kind = ErrUnauthorized
+      err = authErr
+    }
+    return nil, err
   }
 
 	return token, nil
@@ -158,6 +174,22 @@ func (t *target) Token() *rc.TargetToken {
 	return t.token
 }
 
+// LastRequestID returns the X-Request-Id of the last request sent to the ATC.
+func (t *target) LastRequestID() string {
+	if t.requests == nil {
+		return ""
+	}
+	return t.requests.LastRequestID()
+}
+
+// LastStatusCode returns the HTTP status of the last response from the ATC.
+func (t *target) LastStatusCode() int {
+	if t.requests == nil {
+		return 0
+	}
+	return t.requests.LastStatusCode()
+}
+
 func (t *target) Version() (string, error) {
 	info, err := t.getInfo()
 	if err != nil {
@@ -259,12 +291,16 @@ func (t *target) getInfo() (atc.Info, error) {
 		return t.info, nil
 	}
 
-	var err error
-	t.info, err = t.client.GetInfo()
-	return t.info, err
+	info, err := t.client.GetInfo()
+	if err != nil {
+		return atc.Info{}, newAPIError(t, err)
+	}
+
+	t.info = info
+	return t.info, nil
 }
 
-func defaultHttpClient(token *rc.TargetToken, insecure bool, caCertPool *x509.CertPool) *http.Client {
+func defaultHttpClient(token *rc.TargetToken, insecure bool, caCertPool *x509.CertPool, options *targetOptions) *http.Client {
 	var oAuthToken *oauth2.Token
 	if token != nil {
 		oAuthToken = &oauth2.Token{
@@ -273,7 +309,7 @@ func defaultHttpClient(token *rc.TargetToken, insecure bool, caCertPool *x509.Ce
 		}
 	}
 
-	transport := transport(insecure, caCertPool)
+	transport := transport(insecure, caCertPool, options)
 
 	if token != nil {
 		transport = &oauth2.Transport{
@@ -311,7 +347,7 @@ func loadCACertPool(caCert string) (cert *x509.CertPool, err error) {
 	return pool, nil
 }
 
-func transport(insecure bool, caCertPool *x509.CertPool) http.RoundTripper {
+func transport(insecure bool, caCertPool *x509.CertPool, options *targetOptions) http.RoundTripper {
 	var transport http.RoundTripper
 
 	transport = &http.Transport{
@@ -322,7 +358,28 @@ func transport(insecure bool, caCertPool *x509.CertPool) http.RoundTripper {
 		Dial: (&net.Dialer{
 			Timeout: 10 * time.Second,
 		}).Dial,
-		Proxy: http.ProxyFromEnvironment,
+		Proxy: options.proxyFunc,
+	}
+
+	if options.traceLogger != nil {
+		transport = &TracingTransport{
+			Base:     transport,
+			Logger:   options.traceLogger,
+			Level:    options.traceLevel,
+			Redactor: options.redactor,
+		}
+	}
+
+	transport = &LimitTransport{
+		Base:     transport,
+		all:      options.limiter,
+		mutating: options.mutatingLimiter,
+	}
+
+	transport = &RequestIDTransport{
+		Base:      transport,
+		UserAgent: userAgent(options.appName),
+		tracker:   options.requests,
 	}
 
 	return transport
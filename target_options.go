@@ -0,0 +1,113 @@
+package main
+
+import (
+  "net/http"
+  "net/url"
+  "os"
+)
+
+type TargetOption func(*targetOptions)
+
+type targetOptions struct {
+  traceLogger TraceLogger
+  traceLevel  TraceLevel
+  redactor    *Redactor
+
+  rateLimit         RateLimit
+  mutatingRateLimit RateLimit
+
+  proxy *ProxyConfig
+
+  appName string
+
+  // Built once so that the authentication and API clients share a budget.
+  limiter         *limiter
+  mutatingLimiter *limiter
+  proxyFunc       func(*http.Request) (*url.URL, error)
+  requests        *requestTracker
+}
+
+func newTargetOptions(tracing bool, options []TargetOption) (*targetOptions, error) {
+  o := &targetOptions{
+    traceLevel: TraceLevelDebug,
+    proxyFunc:  http.ProxyFromEnvironment,
+    requests:   &requestTracker{},
+  }
+  for _, option := range options {
+    option(o)
+  }
+
+  if tracing && o.traceLogger == nil {
+    o.traceLogger = NewWriterTraceLogger(os.Stdout)
+  }
+
+  o.limiter = newLimiter(o.rateLimit)
+  o.mutatingLimiter = newLimiter(o.mutatingRateLimit)
+
+  if o.proxy != nil {
+    proxyFunc, err := o.proxy.proxyFunc()
+    if err != nil {
+      return nil, err
+    }
+    o.proxyFunc = proxyFunc
+  }
+
+  return o, nil
+}
+
+// WithTraceLogger sends a redacted TraceRecord for every request to logger,
+// regardless of the tracing flag.
+func WithTraceLogger(logger TraceLogger) TargetOption {
+  return func(o *targetOptions) {
+    o.traceLogger = logger
+  }
+}
+
+// WithTraceLevel sets the level attached to trace records. Defaults to
+// TraceLevelDebug.
+func WithTraceLevel(level TraceLevel) TargetOption {
+  return func(o *targetOptions) {
+    o.traceLevel = level
+  }
+}
+
+// WithRateLimit limits every request sent to the target.
+func WithRateLimit(limit RateLimit) TargetOption {
+  return func(o *targetOptions) {
+    o.rateLimit = limit
+  }
+}
+
+// WithMutatingRateLimit adds a separate limit for requests that change state
+// on the ATC, such as CreateOrUpdatePipelineConfig. These requests still count
+// against the WithRateLimit budget.
+func WithMutatingRateLimit(limit RateLimit) TargetOption {
+  return func(o *targetOptions) {
+    o.mutatingRateLimit = limit
+  }
+}
+
+// WithProxy sends the target's requests through proxy, ignoring the proxy
+// environment variables.
+func WithProxy(proxy ProxyConfig) TargetOption {
+  return func(o *targetOptions) {
+    o.proxy = &proxy
+  }
+}
+
+// WithUserAgent prefixes the client's User-Agent with appName, so that the
+// ATC can tell callers apart. appName may carry its own version, as in
+// "deployer/1.2".
+func WithUserAgent(appName string) TargetOption {
+  return func(o *targetOptions) {
+    o.appName = appName
+  }
+}
+
+// WithRedactor masks the values known to redactor in trace records. Pass
+// the same Redactor to EvaluateOptions to mask sensitive variables.
+func WithRedactor(redactor *Redactor) TargetOption {
+  return func(o *targetOptions) {
+    o.redactor = redactor
+  }
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  "github.com/concourse/atc"
+)
+
+// TaskFileRule names the issues found in task files.
+const TaskFileRule = "task-file"
+
+// taskFile is a task step whose config is read from a file.
+type taskFile struct {
+  identifier string
+  step       atc.PlanConfig
+  // path is the local path; config is only set if it could be loaded
+  path   string
+  config *atc.TaskConfig
+  err    error
+}
+
+// taskFileIssues loads the task files of config's task steps from the local
+// directories of inputs, and checks them and the steps using them. Task
+// files in inputs missing from the map are skipped, as they cannot be seen.
+func taskFileIssues(config atc.Config, inputs map[string]string, locator *configLocator) []ConfigIssue {
+  issues := []ConfigIssue{}
+  add := func(severity Severity, identifier string, message string, args ...interface{}) {
+    issues = append(issues, locator.findingIssue(TaskFileRule, severity, LintFinding{
+      Identifier: identifier,
+      Message:    fmt.Sprintf(message, args...),
+    }))
+  }
+
+  for _, job := range config.Jobs {
+    // Each artifact maps to the steps providing it, which are checked as the
+    // walk reaches every task, so only earlier steps count
+    providers := map[string][]string{}
+    provided := func(name string, identifier string) bool {
+      for _, provider := range providers[name] {
+        if !parallelSteps(provider, identifier) {
+          return true
+        }
+      }
+      return false
+    }
+
+    walkJobPlans(job, func(identifier string, step atc.PlanConfig) {
+      switch {
+      case step.Get != "":
+        providers[step.Get] = append(providers[step.Get], identifier)
+      case step.Put != "":
+        // A put fetches what it pushed, under the step's name
+        providers[step.Put] = append(providers[step.Put], identifier)
+      case step.Task != "" && step.TaskConfigPath != "":
+        file := loadTaskFile(identifier, step, inputs)
+        if file == nil {
+          return
+        }
+
+        artifact := strings.SplitN(step.TaskConfigPath, "/", 2)[0]
+        if !provided(artifact, identifier) {
+          add(SeverityError, identifier, "reads task file %s from '%s', which no earlier step of the job provides", step.TaskConfigPath, artifact)
+        }
+        if file.err != nil {
+          add(SeverityError, identifier, "task file %s %s", step.TaskConfigPath, file.err.Error())
+          return
+        }
+        checkTaskFile(file, provided, add)
+        provideOutputs(providers, identifier, step, *file.config)
+      case step.Task != "" && step.TaskConfig != nil:
+        provideOutputs(providers, identifier, step, *step.TaskConfig)
+      }
+    })
+  }
+
+  return issues
+}
+
+// checkTaskFile checks a loaded task file and the step using it.
+func checkTaskFile(file *taskFile, provided func(string, string) bool, add func(Severity, string, string, ...interface{})) {
+  identifier, step := file.identifier, file.step
+
+  declaredInputs := map[string]bool{}
+  for _, input := range file.config.Inputs {
+    declaredInputs[input.Name] = true
+    if input.Optional {
+      continue
+    }
+
+    name := input.Name
+    if mapped, found := step.InputMapping[input.Name]; found {
+      name = mapped
+    }
+    if !provided(name, identifier) {
+      add(SeverityError, identifier, "needs input '%s' of task file %s, which no earlier step of the job provides", name, step.TaskConfigPath)
+    }
+  }
+
+  declaredOutputs := map[string]bool{}
+  for _, output := range file.config.Outputs {
+    declaredOutputs[output.Name] = true
+  }
+
+  for _, name := range sortedKeys(step.InputMapping) {
+    if !declaredInputs[name] {
+      add(SeverityError, identifier, "maps input '%s', which task file %s does not declare", name, step.TaskConfigPath)
+    }
+  }
+  for _, name := range sortedKeys(step.OutputMapping) {
+    if !declaredOutputs[name] {
+      add(SeverityError, identifier, "maps output '%s', which task file %s does not declare", name, step.TaskConfigPath)
+    }
+  }
+
+  // atc passes step params to the task, but warns about undeclared ones
+  params := []string{}
+  for name := range step.Params {
+    if _, found := file.config.Params[name]; !found {
+      params = append(params, name)
+    }
+  }
+  sort.Strings(params)
+  for _, name := range params {
+    add(SeverityWarning, identifier, "sets param '%s', which task file %s does not declare", name, step.TaskConfigPath)
+  }
+}
+
+// loadTaskFile reads the task file of step from inputs, or returns nil if
+// its input is not mapped.
+func loadTaskFile(identifier string, step atc.PlanConfig, inputs map[string]string) *taskFile {
+  parts := strings.SplitN(step.TaskConfigPath, "/", 2)
+  dir, found := inputs[parts[0]]
+  if !found || len(parts) < 2 {
+    return nil
+  }
+
+  file := &taskFile{
+    identifier: identifier,
+    step:       step,
+    path:       filepath.Join(dir, filepath.FromSlash(parts[1])),
+  }
+
+  contents, err := ioutil.ReadFile(file.path)
+  if err != nil {
+    file.err = fmt.Errorf("cannot be read: %s", err.Error())
+    return file
+  }
+
+  config, err := atc.NewTaskConfig(contents)
+  if err != nil {
+    // Validate's messages span lines, under an "invalid task configuration:" header
+    lines := strings.Split(err.Error(), "\n")
+    if len(lines) > 1 {
+      lines = lines[1:]
+    }
+    for i, line := range lines {
+      lines[i] = strings.TrimSpace(line)
+    }
+    file.err = fmt.Errorf("is invalid: %s", strings.Join(lines, "; "))
+    return file
+  }
+
+  file.config = &config
+  return file
+}
+
+func provideOutputs(providers map[string][]string, identifier string, step atc.PlanConfig, config atc.TaskConfig) {
+  for _, output := range config.Outputs {
+    name := output.Name
+    if mapped, found := step.OutputMapping[output.Name]; found {
+      name = mapped
+    }
+    providers[name] = append(providers[name], identifier)
+  }
+}
+
+// parallelSteps reports whether two steps are in different branches of the
+// same aggregate, and so cannot see each other's artifacts.
+func parallelSteps(a string, b string) bool {
+  common := 0
+  for common < len(a) && common < len(b) && a[common] == b[common] {
+    common++
+  }
+
+  prefix := a[:common]
+  i := strings.LastIndex(prefix, ".aggregate[")
+  if i < 0 {
+    return false
+  }
+  return strings.Trim(prefix[i+len(".aggregate["):], "0123456789") == ""
+}
+
+func sortedKeys(values map[string]string) []string {
+  keys := make([]string, 0, len(values))
+  for key := range values {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
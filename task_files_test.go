@@ -0,0 +1,158 @@
+package main
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+)
+
+const taskFilesConfig = `jobs:
+  - name: unit
+    plan:
+      - get: repo
+      - get: ((toolsResource))
+      - task: build
+        file: repo/ci/build.yml
+        output_mapping: {binary: app}
+        params: {GOFLAGS: -mod=vendor}
+      - task: test
+        file: repo/ci/test.yml
+        input_mapping: {source: repo, tools: tools}
+      - task: package
+        file: repo/ci/package.yml
+      - task: release
+        file: other/ci/release.yml
+resources:
+  - name: repo
+    type: git
+  - name: tools
+    type: git
+`
+
+func TestTaskFiles(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "tasks")
+  defer os.RemoveAll(dir)
+  os.Mkdir(filepath.Join(dir, "ci"), 0755)
+  writeTempFile(t, dir, "ci/build.yml", `platform: linux
+run: {path: make}
+inputs: [{name: repo}]
+outputs: [{name: binary}]
+`)
+  writeTempFile(t, dir, "ci/test.yml", `platform: linux
+run: {path: make, args: [test]}
+inputs: [{name: source}, {name: cache, optional: true}, {name: fixtures}]
+`)
+  writeTempFile(t, dir, "ci/package.yml", `run: {path: make}
+inputs: [{name: app}]
+`)
+
+  options := ValidateOptions{
+    EvaluateOptions: EvaluateOptions{Sources: []VarSource{stringMapSource(map[string]string{"toolsResource": "tools"})}},
+    ConfigPath: "pipeline.yml",
+    TaskInputs: map[string]string{"repo": dir},
+  }
+
+  _, err := ValidateConfigWithOptions([]byte(taskFilesConfig), options)
+  assert.True(t, errors.Is(err, ErrInvalidConfig), "Should fail on invalid task files")
+  assert.Equal(t, []ConfigIssue{
+    {
+      Severity: SeverityWarning,
+      Message: "jobs.unit.plan[2].task.build sets param 'GOFLAGS', which task file repo/ci/build.yml does not declare",
+      Location: ConfigLocation{"pipeline.yml", 6, 9},
+      Rule: TaskFileRule,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.unit.plan[3].task.test needs input 'fixtures' of task file repo/ci/test.yml, which no earlier step of the job provides",
+      Location: ConfigLocation{"pipeline.yml", 10, 9},
+      Rule: TaskFileRule,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.unit.plan[3].task.test maps input 'tools', which task file repo/ci/test.yml does not declare",
+      Location: ConfigLocation{"pipeline.yml", 10, 9},
+      Rule: TaskFileRule,
+    },
+    {
+      Severity: SeverityError,
+      Message: "jobs.unit.plan[4].task.package task file repo/ci/package.yml is invalid: missing 'platform'",
+      Location: ConfigLocation{"pipeline.yml", 13, 9},
+      Rule: TaskFileRule,
+    },
+  }, err.(BadConfigError).Issues, "Should check task files the inputs map, and skip others")
+
+  writeTempFile(t, dir, "ci/test.yml", `platform: linux
+run: {path: make, args: [test]}
+inputs: [{name: source}, {name: tools}]
+`)
+  writeTempFile(t, dir, "ci/package.yml", `platform: linux
+run: {path: make}
+inputs: [{name: app}]
+`)
+  warnings, err := ValidateConfigWithOptions([]byte(taskFilesConfig), options)
+  assert.Nil(t, err)
+  assert.Equal(t, []atc.Warning{
+    {Type: "task", Message: "jobs.unit.plan[2].task.build sets param 'GOFLAGS', which task file repo/ci/build.yml does not declare"},
+  }, warnings, "Should accept inputs provided by gets and mapped task outputs")
+
+  os.Remove(filepath.Join(dir, "ci/package.yml"))
+  _, err = ValidateConfigWithOptions([]byte(taskFilesConfig), options)
+  assert.Contains(t, err.Error(), "pipeline.yml:13:9: jobs.unit.plan[4].task.package task file repo/ci/package.yml cannot be read: open ")
+}
+
+func TestTaskFilesStepOrder(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "tasks")
+  defer os.RemoveAll(dir)
+  os.Mkdir(filepath.Join(dir, "ci"), 0755)
+  writeTempFile(t, dir, "ci/build.yml", `platform: linux
+run: {path: make}
+outputs: [{name: app}]
+`)
+  writeTempFile(t, dir, "ci/package.yml", `platform: linux
+run: {path: make}
+inputs: [{name: app}]
+`)
+  writeTempFile(t, dir, "ci/announce.yml", `platform: linux
+run: {path: make}
+inputs: [{name: release}]
+`)
+
+  _, err := ValidateConfigWithOptions([]byte(`jobs:
+  - name: unit
+    plan:
+      - get: repo
+      - task: package
+        file: repo/ci/package.yml
+      - aggregate:
+          - task: build
+            file: repo/ci/build.yml
+          - task: package
+            file: repo/ci/package.yml
+          - do:
+              - task: build
+                file: repo/ci/build.yml
+              - task: package
+                file: repo/ci/package.yml
+      - put: release
+      - task: announce
+        file: repo/ci/announce.yml
+resources:
+  - name: repo
+    type: git
+  - name: release
+    type: github-release
+`), ValidateOptions{TaskInputs: map[string]string{"repo": dir}})
+  assert.True(t, errors.Is(err, ErrInvalidConfig))
+  messages := []string{}
+  for _, issue := range err.(BadConfigError).Issues {
+    messages = append(messages, issue.Message)
+  }
+  assert.Equal(t, []string{
+    "jobs.unit.plan[1].task.package needs input 'app' of task file repo/ci/package.yml, which no earlier step of the job provides",
+    "jobs.unit.plan[2].aggregate[1].task.package needs input 'app' of task file repo/ci/package.yml, which no earlier step of the job provides",
+  }, messages, "Should only count artifacts of earlier steps, puts included, outside parallel branches")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "regexp"
+  "strings"
+)
+
+// A line ending a key or list item with | or >, which starts a block scalar
+var blockScalarRegex = regexp.MustCompile(`(?:^|[\s:-])[|>][-+0-9]*\s*$`)
+
+// MigrateOptions controls MigrateTemplateStyle.
+type MigrateOptions struct {
+  // ConvertEmbedded also converts placeholders in plain, single-quoted and
+  // block strings, which are only reported by default.
+  ConvertEmbedded bool
+}
+
+// TemplatePlaceholder is an old-style {{var}} placeholder found while
+// migrating a config.
+type TemplatePlaceholder struct {
+  Name     string
+  Location ConfigLocation
+
+  // Reason explains why the placeholder was not converted, or what changes
+  // when it is converted anyway.
+  Reason string
+}
+
+// TemplateMigration is the result of MigrateTemplateStyle.
+type TemplateMigration struct {
+  Config      []byte
+  Converted   []TemplatePlaceholder
+  Unconverted []TemplatePlaceholder
+}
+
+// MigrateTemplateStyle rewrites old-style {{var}} placeholders into ((var))
+// ones, leaving the rest of the config, comments and formatting included,
+// byte for byte as it was.
+//
+// {{var}} inserted its value JSON-encoded, quotes included, while ((var))
+// inserts it as is. The two agree when the placeholder is a whole unquoted
+// value, key or flow item, or inside a double-quoted string (where a quoted
+// value was invalid YAML anyway). Elsewhere, converting drops the quotes, so
+// such placeholders are left in place and reported unless ConvertEmbedded is
+// set.
+// path is only used in locations.
+func MigrateTemplateStyle(path string, contents []byte, options MigrateOptions) TemplateMigration {
+  migration := TemplateMigration{
+    Converted:   []TemplatePlaceholder{},
+    Unconverted: []TemplatePlaceholder{},
+  }
+
+  lines := strings.SplitAfter(string(contents), "\n")
+  blockIndent := -1
+  for i, line := range lines {
+    text := strings.TrimRight(line, "\r\n")
+    indent := len(text) - len(strings.TrimLeft(text, " "))
+
+    inBlock := false
+    if blockIndent >= 0 {
+      if strings.TrimSpace(text) == "" || indent > blockIndent {
+        inBlock = true
+      } else {
+        blockIndent = -1
+      }
+    }
+
+    quotes, commentStart := scanYAMLLine(text)
+    if !inBlock && blockScalarRegex.MatchString(text[:commentStart]) {
+      blockIndent = indent
+    }
+
+    matches := deprecatedVarRegex.FindAllStringSubmatchIndex(text, -1)
+    if len(matches) == 0 {
+      continue
+    }
+
+    var rewritten strings.Builder
+    last := 0
+    for _, match := range matches {
+      start, end := match[0], match[1]
+      placeholder := TemplatePlaceholder{
+        Name:     text[match[2]:match[3]],
+        Location: ConfigLocation{Path: path, Line: i + 1, Column: start + 1},
+      }
+
+      // Comments are converted like the rest, to keep them accurate
+      unsafe := inBlock || (start < commentStart && (quotes[start] == '\'' ||
+        (quotes[start] == 0 && !placeholderIsWhole(text, start, end))))
+
+      convert := true
+      if unsafe {
+        placeholder.Reason = fmt.Sprintf(
+          "is embedded in a string, where {{%s}} inserted the value JSON-encoded, quotes included, and ((%s)) does not",
+          placeholder.Name, placeholder.Name)
+        convert = options.ConvertEmbedded
+      }
+
+      rewritten.WriteString(text[last:start])
+      if convert {
+        rewritten.WriteString("((" + placeholder.Name + "))")
+        migration.Converted = append(migration.Converted, placeholder)
+      } else {
+        rewritten.WriteString(text[start:end])
+        migration.Unconverted = append(migration.Unconverted, placeholder)
+      }
+      last = end
+    }
+    rewritten.WriteString(line[last:])
+    lines[i] = rewritten.String()
+  }
+
+  migration.Config = []byte(strings.Join(lines, ""))
+  return migration
+}
+
+// MigrateTemplateFile migrates a config file in place.
+func MigrateTemplateFile(path string, options MigrateOptions) (TemplateMigration, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return TemplateMigration{}, err
+  }
+
+  contents, err := ioutil.ReadFile(path)
+  if err != nil {
+    return TemplateMigration{}, err
+  }
+
+  migration := MigrateTemplateStyle(path, contents, options)
+  if len(migration.Converted) == 0 {
+    return migration, nil
+  }
+
+  return migration, ioutil.WriteFile(path, migration.Config, info.Mode())
+}
+
+// scanYAMLLine returns, for every byte of a line, the quote of the string it
+// is in, if any, and where the line's comment starts (len(line) if there is
+// none). Quotes only open a string at the start of a scalar, so the
+// apostrophe in "it's" does not count.
+func scanYAMLLine(line string) ([]byte, int) {
+  quotes := make([]byte, len(line)+1)
+  var quote byte
+  for i := 0; i < len(line); i++ {
+    c := line[i]
+    switch {
+    case quote == '"' && c == '\\':
+      quotes[i] = quote
+      i++
+      if i < len(line) {
+        quotes[i] = quote
+      }
+      continue
+    case quote == '\'' && c == '\'' && i+1 < len(line) && line[i+1] == '\'':
+      quotes[i], quotes[i+1] = quote, quote
+      i++
+      continue
+    case quote != 0 && c == quote:
+      quote = 0
+    case quote == 0 && (c == '"' || c == '\'') && startsScalar(line[:i]):
+      quote = c
+    case quote == 0 && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+      return quotes, i
+    }
+    quotes[i] = quote
+  }
+  return quotes, len(line)
+}
+
+func startsScalar(before string) bool {
+  trimmed := strings.TrimRight(before, " \t")
+  if trimmed == "" {
+    return true
+  }
+  if len(trimmed) == len(before) && !strings.ContainsAny(trimmed[len(trimmed)-1:], "[{,") {
+    return false
+  }
+  return strings.ContainsAny(trimmed[len(trimmed)-1:], ":-[{,?")
+}
+
+// placeholderIsWhole reports whether the unquoted placeholder at
+// line[start:end] is a whole scalar: a value, a key or a flow item.
+func placeholderIsWhole(line string, start, end int) bool {
+  after := strings.TrimLeft(line[end:], " \t")
+  return startsScalar(line[:start]) &&
+    (after == "" || strings.ContainsAny(after[:1], "#,]}") || after == ":" || strings.HasPrefix(after, ": "))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+const oldStyleConfig = `# Deploys {{env}}
+jobs:
+  - name: {{env}}-deploy   # not converted
+    plan:
+      - get: repo
+        params: {depth: {{depth}}}
+      - task: migrate
+        config:
+          params:
+            URL: "https://{{host}}:{{port}}"
+            TAG: 'v{{version}}'
+          run:
+            path: sh
+            args:
+              - -c
+              - |
+                echo {{env}}
+resources:
+  - name: repo
+    type: git
+    source:
+      uri: {{uri}}
+      branch: "{{branch}}"
+      {{key}}: value
+`
+
+func TestMigrateTemplateStyle(t *testing.T) {
+  migration := MigrateTemplateStyle("pipeline.yml", []byte(oldStyleConfig), MigrateOptions{})
+  assert.Equal(t, `# Deploys ((env))
+jobs:
+  - name: {{env}}-deploy   # not converted
+    plan:
+      - get: repo
+        params: {depth: ((depth))}
+      - task: migrate
+        config:
+          params:
+            URL: "https://((host)):((port))"
+            TAG: 'v{{version}}'
+          run:
+            path: sh
+            args:
+              - -c
+              - |
+                echo {{env}}
+resources:
+  - name: repo
+    type: git
+    source:
+      uri: ((uri))
+      branch: "((branch))"
+      ((key)): value
+`, string(migration.Config), "Should only convert placeholders with the same meaning")
+
+  unconverted := []string{}
+  for _, placeholder := range migration.Unconverted {
+    unconverted = append(unconverted, placeholder.Location.String()+" "+placeholder.Name)
+  }
+  assert.Equal(t, []string{
+    "pipeline.yml:3:11 env",
+    "pipeline.yml:11:20 version",
+    "pipeline.yml:17:22 env",
+  }, unconverted)
+  assert.Equal(t, "is embedded in a string, where {{env}} inserted the value JSON-encoded, quotes included, and ((env)) does not", migration.Unconverted[0].Reason)
+  assert.Len(t, migration.Converted, 7)
+
+  migration = MigrateTemplateStyle("pipeline.yml", []byte(oldStyleConfig), MigrateOptions{ConvertEmbedded: true})
+  assert.Empty(t, migration.Unconverted)
+  assert.Len(t, migration.Converted, 10)
+  assert.NotContains(t, string(migration.Config), "{{")
+}
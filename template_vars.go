@@ -0,0 +1,173 @@
+package main
+
+import (
+  "fmt"
+  "path"
+  "regexp"
+  "sort"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+)
+
+// Same syntax as bosh-cli's template interpolation
+var varRefRegex = regexp.MustCompile(`\(\((!?[-/\.\w\pL]+)\)\)`)
+
+// varRef is a ((var)) occurrence in a config. Path locates the value holding
+// it, as in "jobs[0].plan[1].config.run.args[0]".
+type varRef struct {
+  Name string
+  Path string
+}
+
+// rootName returns the variable a ref looks up: ((repo.uri)) reads "repo".
+func (r varRef) rootName() string {
+  return strings.SplitN(r.Name, ".", 2)[0]
+}
+
+func findVarRefs(configPayload []byte) ([]varRef, error) {
+  var config interface{}
+  err := yaml.Unmarshal(configPayload, &config)
+  if err != nil {
+    return nil, err
+  }
+
+  refs := []varRef{}
+  walkVarRefs(config, "", &refs)
+  return refs, nil
+}
+
+func walkVarRefs(node interface{}, nodePath string, refs *[]varRef) {
+  switch typedNode := node.(type) {
+  case map[interface{}]interface{}:
+    keys := make([]string, 0, len(typedNode))
+    values := map[string]interface{}{}
+    for k, v := range typedNode {
+      key := fmt.Sprintf("%v", k)
+      keys = append(keys, key)
+      values[key] = v
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+      childPath := joinYAMLPath(nodePath, key)
+      walkVarRefs(key, childPath, refs)
+      walkVarRefs(values[key], childPath, refs)
+    }
+
+  case []interface{}:
+    for i, child := range typedNode {
+      walkVarRefs(child, fmt.Sprintf("%s[%d]", nodePath, i), refs)
+    }
+
+  case string:
+    for _, match := range varRefRegex.FindAllStringSubmatch(typedNode, -1) {
+      *refs = append(*refs, varRef{
+        Name: strings.TrimPrefix(match[1], "!"),
+        Path: nodePath,
+      })
+    }
+  }
+}
+
+func joinYAMLPath(parent, key string) string {
+  if parent == "" {
+    return key
+  }
+  return parent + "." + key
+}
+
+// UnresolvedVar is a ((var)) that none of the var sources provides.
+type UnresolvedVar struct {
+  Name string
+  Path string
+}
+
+// UnresolvedVarsError lists every unresolved variable of a config, so that
+// they can all be fixed at once.
+type UnresolvedVarsError struct {
+  Vars []UnresolvedVar
+}
+
+func (err UnresolvedVarsError) Error() string {
+  lines := []string{"unresolved template variables:"}
+  for _, v := range err.Vars {
+    lines = append(lines, fmt.Sprintf("  ((%s)) at %s", v.Name, v.Path))
+  }
+  return strings.Join(lines, "\n")
+}
+
+// checkUnresolvedVars fails if one of refs is missing from sources, unless
+// it matches one of the serverSideVars patterns. Unless expectAllVars is
+// set, only refs to missing fields of provided vars fail, as interpolation
+// cannot leave those for the server.
+func checkUnresolvedVars(refs []varRef, sources []loadedVarSource, serverSideVars []string, expectAllVars bool) error {
+  unresolved := []UnresolvedVar{}
+  for _, ref := range refs {
+    if varProvided(ref.Name, sources) {
+      continue
+    }
+
+    if !varProvided(ref.rootName(), sources) {
+      if !expectAllVars {
+        continue
+      }
+
+      serverSide, err := matchesVarPattern(ref.Name, serverSideVars)
+      if err != nil {
+        return err
+      }
+      if serverSide {
+        continue
+      }
+    }
+
+    unresolved = append(unresolved, UnresolvedVar{Name: ref.Name, Path: ref.Path})
+  }
+
+  if len(unresolved) > 0 {
+    return UnresolvedVarsError{Vars: unresolved}
+  }
+
+  return nil
+}
+
+// varProvided looks name up like interpolation does: ((creds.user)) reads
+// the user field of the highest precedence creds.
+func varProvided(name string, sources []loadedVarSource) bool {
+  keys := strings.Split(name, ".")
+  value, found := effectiveValue(keys[0], sources)
+  for _, key := range keys[1:] {
+    if !found {
+      return false
+    }
+
+    switch typedValue := value.(type) {
+    case map[interface{}]interface{}:
+      value, found = typedValue[key]
+    case map[string]interface{}:
+      value, found = typedValue[key]
+    default:
+      return false
+    }
+  }
+  return found
+}
+
+// matchesVarPattern matches either the full name or its root against
+// path.Match patterns, so "vault-*" and "github" both cover ((github.token)).
+func matchesVarPattern(name string, patterns []string) (bool, error) {
+  root := varRef{Name: name}.rootName()
+  for _, pattern := range patterns {
+    for _, candidate := range []string{name, root} {
+      matched, err := path.Match(pattern, candidate)
+      if err != nil {
+        return false, fmt.Errorf("invalid var pattern '%s': %s", pattern, err.Error())
+      }
+      if matched {
+        return true, nil
+      }
+    }
+  }
+  return false, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "mime"
+  "net/http"
+  "net/url"
+  "strings"
+  "sync"
+  "time"
+)
+
+const redacted = "[REDACTED]"
+
+type TraceLevel int
+
+const (
+  TraceLevelDebug TraceLevel = iota
+  TraceLevelInfo
+)
+
+func (l TraceLevel) String() string {
+  switch l {
+  case TraceLevelDebug:
+    return "debug"
+  case TraceLevelInfo:
+    return "info"
+  default:
+    return fmt.Sprintf("level(%d)", int(l))
+  }
+}
+
+// TraceRecord describes a single HTTP exchange with the ATC. Credentials are
+// redacted before the record reaches a TraceLogger.
+type TraceRecord struct {
+  Level          TraceLevel
+  RequestID      string
+  Method         string
+  URL            string
+  RequestHeaders http.Header
+  RequestForm    url.Values
+  RequestSize    int64
+  Status         int
+  ResponseSize   int64
+  Duration       time.Duration
+  Err            error
+}
+
+type TraceLogger interface {
+  Trace(record TraceRecord)
+}
+
+type TraceLoggerFunc func(record TraceRecord)
+
+func (f TraceLoggerFunc) Trace(record TraceRecord) {
+  f(record)
+}
+
+type writerTraceLogger struct {
+  lock sync.Mutex
+  w    io.Writer
+}
+
+// NewWriterTraceLogger returns a TraceLogger that writes one logfmt line per
+// record to w.
+func NewWriterTraceLogger(w io.Writer) TraceLogger {
+  return &writerTraceLogger{w: w}
+}
+
+func (l *writerTraceLogger) Trace(record TraceRecord) {
+  line := fmt.Sprintf("level=%s request_id=%s method=%s url=%q status=%d duration=%s request_size=%d response_size=%d",
+    record.Level, record.RequestID, record.Method, record.URL, record.Status, record.Duration,
+    record.RequestSize, record.ResponseSize)
+  if record.Err != nil {
+    line += fmt.Sprintf(" error=%q", record.Err.Error())
+  }
+
+  l.lock.Lock()
+  defer l.lock.Unlock()
+  fmt.Fprintln(l.w, line)
+}
+
+var sensitiveHeaders = []string{
+  "Authorization",
+  "Proxy-Authorization",
+  "Cookie",
+}
+
+var sensitiveParams = map[string]bool{
+  "access_token":  true,
+  "client_secret": true,
+  "password":      true,
+  "refresh_token": true,
+  "token":         true,
+}
+
+// TracingTransport reports every request it sends to Logger. It replaces the
+// raw request dumps go-concourse prints when tracing is enabled, which leak
+// bearer tokens and password grants.
+type TracingTransport struct {
+  Base     http.RoundTripper
+  Logger   TraceLogger
+  Level    TraceLevel
+  Redactor *Redactor
+}
+
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  record := TraceRecord{
+    Level:          t.Level,
+    RequestID:      req.Header.Get(RequestIDHeader),
+    Method:         req.Method,
+    URL:            t.Redactor.Redact(redactURL(req.URL)),
+    RequestHeaders: redactHeaders(req.Header),
+    RequestSize:    req.ContentLength,
+  }
+
+  if isFormRequest(req) && req.Body != nil {
+    body, err := ioutil.ReadAll(req.Body)
+    req.Body.Close()
+    if err != nil {
+      return nil, err
+    }
+
+    req = req.Clone(req.Context())
+    req.Body = ioutil.NopCloser(bytes.NewReader(body))
+    req.GetBody = func() (io.ReadCloser, error) {
+      return ioutil.NopCloser(bytes.NewReader(body)), nil
+    }
+
+    if form, err := url.ParseQuery(string(body)); err == nil {
+      record.RequestForm = redactValues(form)
+      for _, values := range record.RequestForm {
+        for i, value := range values {
+          values[i] = t.Redactor.Redact(value)
+        }
+      }
+    }
+  }
+
+  start := time.Now()
+  resp, err := t.Base.RoundTrip(req)
+  record.Duration = time.Since(start)
+  if err != nil {
+    record.Err = t.Redactor.RedactError(err)
+    t.Logger.Trace(record)
+    return nil, err
+  }
+
+  record.Status = resp.StatusCode
+  resp.Body = &tracedBody{
+    ReadCloser: resp.Body,
+    record:     record,
+    logger:     t.Logger,
+  }
+
+  return resp, nil
+}
+
+// tracedBody emits its record once the response has been consumed, so that
+// the response size is known.
+type tracedBody struct {
+  io.ReadCloser
+  record TraceRecord
+  logger TraceLogger
+  once   sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+  n, err := b.ReadCloser.Read(p)
+  b.record.ResponseSize += int64(n)
+  return n, err
+}
+
+func (b *tracedBody) Close() error {
+  err := b.ReadCloser.Close()
+  b.once.Do(func() {
+    b.logger.Trace(b.record)
+  })
+  return err
+}
+
+func isFormRequest(req *http.Request) bool {
+  mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+  return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+func redactHeaders(header http.Header) http.Header {
+  redactedHeader := header.Clone()
+  for _, name := range sensitiveHeaders {
+    if _, ok := redactedHeader[name]; ok {
+      redactedHeader[name] = []string{redacted}
+    }
+  }
+  return redactedHeader
+}
+
+func redactValues(values url.Values) url.Values {
+  redactedValues := url.Values{}
+  for name, vs := range values {
+    if sensitiveParams[strings.ToLower(name)] {
+      redactedValues[name] = []string{redacted}
+    } else {
+      redactedValues[name] = vs
+    }
+  }
+  return redactedValues
+}
+
+func redactURL(u *url.URL) string {
+  redactedURL := *u
+  if redactedURL.User != nil {
+    redactedURL.User = url.User(redactedURL.User.Username())
+  }
+  if redactedURL.RawQuery != "" {
+    redactedURL.RawQuery = redactValues(redactedURL.Query()).Encode()
+  }
+  return redactedURL.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "strings"
+  "testing"
+  "github.com/stretchr/testify/assert"
+)
+
+func newTracedClient(records *[]TraceRecord) *http.Client {
+  return &http.Client{Transport: &TracingTransport{
+    Base: http.DefaultTransport,
+    Logger: TraceLoggerFunc(func(record TraceRecord) {
+      *records = append(*records, record)
+    }),
+    Level: TraceLevelInfo,
+  }}
+}
+
+func TestTraceRedactsAuthorization(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"), "Should send the real header")
+    w.Write([]byte("hello"))
+  }))
+  defer server.Close()
+
+  var records []TraceRecord
+  req, _ := http.NewRequest("GET", server.URL+"/api/v1/info?token=secret", nil)
+  req.Header.Set("Authorization", "Bearer secret")
+  resp, err := newTracedClient(&records).Do(req)
+  assert.Nil(t, err)
+  ioutil.ReadAll(resp.Body)
+  resp.Body.Close()
+
+  assert.Len(t, records, 1, "Should emit one record per request")
+  record := records[0]
+  assert.Equal(t, TraceLevelInfo, record.Level)
+  assert.Equal(t, "GET", record.Method)
+  assert.Equal(t, 200, record.Status)
+  assert.Equal(t, int64(5), record.ResponseSize)
+  assert.Equal(t, redacted, record.RequestHeaders.Get("Authorization"), "Should redact authorization")
+  assert.NotContains(t, record.URL, "secret", "Should redact tokens in the query")
+}
+
+func TestTraceRedactsFormPassword(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    assert.Equal(t, "hunter2", r.PostForm.Get("password"), "Should send the real body")
+  }))
+  defer server.Close()
+
+  var records []TraceRecord
+  resp, err := newTracedClient(&records).PostForm(server.URL+"/sky/token", url.Values{
+    "grant_type": {"password"},
+    "username":   {"test"},
+    "password":   {"hunter2"},
+  })
+  assert.Nil(t, err)
+  resp.Body.Close()
+
+  assert.Len(t, records, 1)
+  assert.Equal(t, "test", records[0].RequestForm.Get("username"))
+  assert.Equal(t, redacted, records[0].RequestForm.Get("password"), "Should redact passwords")
+}
+
+func TestWriterTraceLogger(t *testing.T) {
+  var out strings.Builder
+  NewWriterTraceLogger(&out).Trace(TraceRecord{
+    Level: TraceLevelDebug,
+    RequestID: "1234",
+    Method: "PUT",
+    URL: "http://concourse/api/v1/teams/main/pipelines/foo/config",
+    Status: 200,
+  })
+  assert.Contains(t, out.String(), "level=debug request_id=1234 method=PUT")
+  assert.Contains(t, out.String(), "status=200")
+}
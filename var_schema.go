@@ -0,0 +1,337 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "regexp"
+  "strconv"
+  "strings"
+
+  yamlv3 "gopkg.in/yaml.v3"
+)
+
+// VarSchema declares the variables a pipeline expects. It is usually kept
+// next to the pipeline, as in:
+//
+//   vars:
+//     branch:
+//       type: string
+//       required: true
+//       pattern: "^[a-z0-9-]+$"
+//     environment:
+//       enum: [staging, production]
+//     replicas:
+//       type: int
+//       default: 2
+type VarSchema struct {
+  Path string
+  Vars []VarDeclaration
+}
+
+// VarDeclaration constrains a single variable. Type is one of string, int,
+// bool, list or map, and may be left out to accept anything.
+type VarDeclaration struct {
+  Name     string        `yaml:"-"`
+  Type     string        `yaml:"type"`
+  Required bool          `yaml:"required"`
+  Pattern  string        `yaml:"pattern"`
+  Enum     []interface{} `yaml:"enum"`
+  Default  interface{}   `yaml:"default"`
+
+  Location SchemaLocation `yaml:"-"`
+  pattern  *regexp.Regexp
+}
+
+// SchemaLocation points into a schema file.
+type SchemaLocation struct {
+  Path   string
+  Line   int
+  Column int
+}
+
+func (l SchemaLocation) String() string {
+  return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.Column)
+}
+
+type VarSchemaViolation struct {
+  Name     string
+  Message  string
+  Location SchemaLocation
+}
+
+// VarSchemaError aggregates every variable that does not satisfy a schema.
+type VarSchemaError struct {
+  Violations []VarSchemaViolation
+}
+
+func (err VarSchemaError) Error() string {
+  lines := []string{"template variables do not match their schema:"}
+  for _, v := range err.Violations {
+    lines = append(lines, fmt.Sprintf("  %s: ((%s)) %s", v.Location, v.Name, v.Message))
+  }
+  return strings.Join(lines, "\n")
+}
+
+func (err VarSchemaError) Is(target error) bool {
+  return target == ErrInvalidConfig
+}
+
+func LoadVarSchema(path string) (*VarSchema, error) {
+  contents, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, fmt.Errorf("could not read var schema (%s): %s", path, err.Error())
+  }
+
+  return ParseVarSchema(path, contents)
+}
+
+// ParseVarSchema parses a schema. path is only used to locate errors.
+func ParseVarSchema(path string, contents []byte) (*VarSchema, error) {
+  var document yamlv3.Node
+  err := yamlv3.Unmarshal(contents, &document)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse var schema (%s): %s", path, err.Error())
+  }
+
+  schema := &VarSchema{Path: path, Vars: []VarDeclaration{}}
+  if len(document.Content) == 0 {
+    return schema, nil
+  }
+
+  varsNode := mappingValue(document.Content[0], "vars")
+  if varsNode == nil {
+    return schema, nil
+  }
+  if varsNode.Kind != yamlv3.MappingNode {
+    return nil, fmt.Errorf("%s:%d:%d: vars must be a map", path, varsNode.Line, varsNode.Column)
+  }
+
+  violations := []VarSchemaViolation{}
+  for i := 0; i+1 < len(varsNode.Content); i += 2 {
+    keyNode, valueNode := varsNode.Content[i], varsNode.Content[i+1]
+    location := SchemaLocation{Path: path, Line: keyNode.Line, Column: keyNode.Column}
+
+    var decl VarDeclaration
+    if err := valueNode.Decode(&decl); err != nil {
+      violations = append(violations, VarSchemaViolation{
+        Name: keyNode.Value, Message: "has an invalid declaration: " + err.Error(), Location: location,
+      })
+      continue
+    }
+    decl.Name = keyNode.Value
+    decl.Location = location
+
+    switch decl.Type {
+    case "", "string", "int", "bool", "list", "map":
+    default:
+      violations = append(violations, VarSchemaViolation{
+        Name: decl.Name, Message: fmt.Sprintf("has unknown type '%s'", decl.Type), Location: location,
+      })
+    }
+
+    if decl.Pattern != "" {
+      decl.pattern, err = regexp.Compile(decl.Pattern)
+      if err != nil {
+        violations = append(violations, VarSchemaViolation{
+          Name: decl.Name, Message: "has an invalid pattern: " + err.Error(), Location: location,
+        })
+      }
+    }
+
+    schema.Vars = append(schema.Vars, decl)
+  }
+
+  if len(violations) > 0 {
+    return nil, VarSchemaError{Violations: violations}
+  }
+
+  return schema, nil
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+  if node == nil || node.Kind != yamlv3.MappingNode {
+    return nil
+  }
+  for i := 0; i+1 < len(node.Content); i += 2 {
+    if node.Content[i].Value == key {
+      return node.Content[i+1]
+    }
+  }
+  return nil
+}
+
+// apply validates the effective value of every declared variable and returns
+// sources with the schema defaults added at the lowest precedence.
+func (schema *VarSchema) apply(sources []loadedVarSource) ([]loadedVarSource, error) {
+  defaults := map[string]interface{}{}
+  violations := []VarSchemaViolation{}
+
+  for _, decl := range schema.Vars {
+    value, found := effectiveValue(decl.Name, sources)
+    if !found {
+      if decl.Default != nil {
+        defaults[decl.Name] = normalizeYAMLv3Value(decl.Default)
+        value, found = decl.Default, true
+      } else if decl.Required {
+        violations = append(violations, VarSchemaViolation{
+          Name: decl.Name, Message: "is required but not provided", Location: decl.Location,
+        })
+        continue
+      }
+    }
+
+    if !found {
+      continue
+    }
+
+    for _, message := range decl.check(value) {
+      violations = append(violations, VarSchemaViolation{
+        Name: decl.Name, Message: message, Location: decl.Location,
+      })
+    }
+  }
+
+  if len(violations) > 0 {
+    return nil, VarSchemaError{Violations: violations}
+  }
+
+  if len(defaults) == 0 {
+    return sources, nil
+  }
+
+  withDefaults := []loadedVarSource{{
+    name: fmt.Sprintf("defaults (%s)", schema.Path),
+    vars: defaults,
+  }}
+  return append(withDefaults, sources...), nil
+}
+
+func effectiveValue(name string, sources []loadedVarSource) (interface{}, bool) {
+  for i := len(sources) - 1; i >= 0; i-- {
+    if value, found := sources[i].vars[name]; found {
+      return value, true
+    }
+  }
+  return nil, false
+}
+
+// check returns a message for every constraint value breaks. String flags
+// (-v) can only carry strings, so ints and bools are also accepted in their
+// string form.
+func (decl VarDeclaration) check(value interface{}) []string {
+  messages := []string{}
+
+  switch decl.Type {
+  case "string":
+    if _, ok := value.(string); !ok {
+      messages = append(messages, fmt.Sprintf("must be a string, got %s", describeType(value)))
+    }
+  case "int":
+    switch v := value.(type) {
+    case int, int64, uint64:
+    case string:
+      if _, err := strconv.Atoi(v); err != nil {
+        messages = append(messages, fmt.Sprintf("must be an int, got '%s'", v))
+      }
+    default:
+      messages = append(messages, fmt.Sprintf("must be an int, got %s", describeType(value)))
+    }
+  case "bool":
+    switch v := value.(type) {
+    case bool:
+    case string:
+      if _, err := strconv.ParseBool(v); err != nil {
+        messages = append(messages, fmt.Sprintf("must be a bool, got '%s'", v))
+      }
+    default:
+      messages = append(messages, fmt.Sprintf("must be a bool, got %s", describeType(value)))
+    }
+  case "list":
+    if _, ok := value.([]interface{}); !ok {
+      messages = append(messages, fmt.Sprintf("must be a list, got %s", describeType(value)))
+    }
+  case "map":
+    switch value.(type) {
+    case map[interface{}]interface{}, map[string]interface{}:
+    default:
+      messages = append(messages, fmt.Sprintf("must be a map, got %s", describeType(value)))
+    }
+  }
+
+  if decl.pattern != nil && isScalar(value) && !decl.pattern.MatchString(fmt.Sprintf("%v", value)) {
+    messages = append(messages, fmt.Sprintf("does not match pattern '%s'", decl.Pattern))
+  }
+
+  if len(decl.Enum) > 0 && !decl.allows(value) {
+    allowed := []string{}
+    for _, v := range decl.Enum {
+      allowed = append(allowed, fmt.Sprintf("%v", v))
+    }
+    messages = append(messages, fmt.Sprintf("must be one of [%s]", strings.Join(allowed, ", ")))
+  }
+
+  return messages
+}
+
+func (decl VarDeclaration) allows(value interface{}) bool {
+  if !isScalar(value) {
+    return false
+  }
+  for _, allowed := range decl.Enum {
+    if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", value) {
+      return true
+    }
+  }
+  return false
+}
+
+func isScalar(value interface{}) bool {
+  switch value.(type) {
+  case map[interface{}]interface{}, map[string]interface{}, []interface{}, nil:
+    return false
+  default:
+    return true
+  }
+}
+
+func describeType(value interface{}) string {
+  switch value.(type) {
+  case string:
+    return "a string"
+  case int, int64, uint64:
+    return "an int"
+  case float64:
+    return "a float"
+  case bool:
+    return "a bool"
+  case []interface{}:
+    return "a list"
+  case map[interface{}]interface{}, map[string]interface{}:
+    return "a map"
+  case nil:
+    return "null"
+  default:
+    return fmt.Sprintf("%T", value)
+  }
+}
+
+// normalizeYAMLv3Value converts maps decoded by yaml.v3 into the
+// map[interface{}]interface{} form yaml.v2 and bosh-cli's templates expect.
+func normalizeYAMLv3Value(value interface{}) interface{} {
+  switch typed := value.(type) {
+  case map[string]interface{}:
+    normalized := map[interface{}]interface{}{}
+    for k, v := range typed {
+      normalized[k] = normalizeYAMLv3Value(v)
+    }
+    return normalized
+  case []interface{}:
+    normalized := make([]interface{}, len(typed))
+    for i, v := range typed {
+      normalized[i] = normalizeYAMLv3Value(v)
+    }
+    return normalized
+  default:
+    return value
+  }
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+const testVarSchema = `vars:
+  branch:
+    type: string
+    required: true
+    pattern: "^[a-z-]+$"
+  environment:
+    enum: [staging, production]
+  replicas:
+    type: int
+    default: 2
+  args:
+    type: list
+    default: [hello, world]
+`
+
+func TestVarSchemaDefaults(t *testing.T) {
+  schema, err := ParseVarSchema("vars-schema.yml", []byte(testVarSchema))
+  assert.Nil(t, err)
+
+  configYaml, err := EvaluateConfigWithOptions([]byte(`jobs:
+  - name: ((branch))-((replicas))
+    plan: [{task: t, config: {run: {path: echo, args: ((args))}}}]`), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{"branch": "main", "environment": "staging"}},
+    },
+    Schema: schema,
+  })
+  assert.Nil(t, err)
+  var config atc.Config
+  _ = yaml.Unmarshal(configYaml, &config)
+  assert.Equal(t, "main-2", config.Jobs[0].Name, "Should fill in scalar defaults")
+  assert.Equal(t, []string{"hello", "world"}, config.Jobs[0].Plan[0].TaskConfig.Run.Args, "Should fill in list defaults")
+}
+
+func TestVarSchemaViolations(t *testing.T) {
+  schema, err := ParseVarSchema("vars-schema.yml", []byte(testVarSchema))
+  assert.Nil(t, err)
+
+  _, err = EvaluateConfigWithOptions([]byte(`jobs: []`), EvaluateOptions{
+    Sources: []VarSource{
+      StaticVarSource{Vars: map[string]interface{}{"environment": "qa", "replicas": "many"}},
+    },
+    Schema: schema,
+  })
+  assert.IsType(t, VarSchemaError{}, err, "Should reject vars that break the schema")
+  assert.Equal(t, []VarSchemaViolation{
+    {Name: "branch", Message: "is required but not provided", Location: SchemaLocation{"vars-schema.yml", 2, 3}},
+    {Name: "environment", Message: "must be one of [staging, production]", Location: SchemaLocation{"vars-schema.yml", 6, 3}},
+    {Name: "replicas", Message: "must be an int, got 'many'", Location: SchemaLocation{"vars-schema.yml", 8, 3}},
+  }, err.(VarSchemaError).Violations, "Should aggregate violations with their location")
+  assert.Contains(t, err.Error(), "vars-schema.yml:2:3: ((branch)) is required but not provided")
+}
+
+func TestInvalidVarSchema(t *testing.T) {
+  _, err := ParseVarSchema("vars-schema.yml", []byte(`vars:
+  branch: {type: text}
+  tag: {pattern: "(("}`))
+  assert.IsType(t, VarSchemaError{}, err, "Should reject invalid declarations")
+  assert.Len(t, err.(VarSchemaError).Violations, 2)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  yaml "gopkg.in/yaml.v2"
+
+  "github.com/concourse/atc"
+  "github.com/ribaptista/concourse-poc/flaghelpers"
+)
+
+// VarSource provides values for template variables. Sources are passed in
+// order of increasing precedence: when more than one source defines a
+// variable, the last one wins. This is the order fly applies to var files
+// (-l), string flags (-v) and YAML flags (-y).
+type VarSource interface {
+  // Name describes the source in error messages and reports.
+  Name() string
+  Variables() (map[string]interface{}, error)
+}
+
+// StaticVarSource provides variables from memory.
+type StaticVarSource struct {
+  Label string
+  Vars  map[string]interface{}
+}
+
+func (s StaticVarSource) Name() string {
+  if s.Label == "" {
+    return "static vars"
+  }
+  return s.Label
+}
+
+func (s StaticVarSource) Variables() (map[string]interface{}, error) {
+  return s.Vars, nil
+}
+
+// YAMLFileVarSource reads variables from a YAML var file, like fly's -l.
+type YAMLFileVarSource struct {
+  Path string
+}
+
+func (s YAMLFileVarSource) Name() string {
+  return s.Path
+}
+
+func (s YAMLFileVarSource) Variables() (map[string]interface{}, error) {
+  payload, err := ioutil.ReadFile(s.Path)
+  if err != nil {
+    return nil, fmt.Errorf("could not read template variables file (%s): %s", s.Path, err.Error())
+  }
+
+  var vars map[string]interface{}
+  err = yaml.Unmarshal(payload, &vars)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse template variables file (%s): %s", s.Path, err.Error())
+  }
+
+  return vars, nil
+}
+
+// EnvVarSource provides a variable for every environment variable starting
+// with Prefix. The prefix is stripped from the variable name, so with the
+// prefix "CI_VAR_", CI_VAR_branch provides ((branch)).
+type EnvVarSource struct {
+  Prefix string
+}
+
+func (s EnvVarSource) Name() string {
+  return fmt.Sprintf("environment (%s*)", s.Prefix)
+}
+
+func (s EnvVarSource) Variables() (map[string]interface{}, error) {
+  if s.Prefix == "" {
+    return nil, errors.New("environment var source needs a prefix")
+  }
+
+  vars := map[string]interface{}{}
+  for _, env := range os.Environ() {
+    pair := strings.SplitN(env, "=", 2)
+    if len(pair) != 2 || !strings.HasPrefix(pair[0], s.Prefix) {
+      continue
+    }
+
+    name := strings.TrimPrefix(pair[0], s.Prefix)
+    if name != "" {
+      vars[name] = pair[1]
+    }
+  }
+
+  return vars, nil
+}
+
+// DirVarSource provides a variable for every regular file in Path, named
+// after the file and holding its contents, as mounted secrets are laid out.
+// Hidden files and subdirectories are skipped, and a single trailing newline
+// is trimmed from each value.
+type DirVarSource struct {
+  Path string
+}
+
+func (s DirVarSource) Name() string {
+  return s.Path + string(filepath.Separator)
+}
+
+func (s DirVarSource) Variables() (map[string]interface{}, error) {
+  entries, err := ioutil.ReadDir(s.Path)
+  if err != nil {
+    return nil, fmt.Errorf("could not read template variables directory (%s): %s", s.Path, err.Error())
+  }
+
+  vars := map[string]interface{}{}
+  for _, entry := range entries {
+    if !entry.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+      continue
+    }
+
+    value, err := ioutil.ReadFile(filepath.Join(s.Path, entry.Name()))
+    if err != nil {
+      return nil, fmt.Errorf("could not read template variable (%s): %s", entry.Name(), err.Error())
+    }
+
+    vars[entry.Name()] = strings.TrimSuffix(string(value), "\n")
+  }
+
+  return vars, nil
+}
+
+// FlagVarSources returns the sources fly builds from its -l, -v and -y
+// flags, in fly's order of precedence.
+func FlagVarSources(
+  templateVariables []flaghelpers.VariablePairFlag,
+  yamlTemplateVariables []flaghelpers.YAMLVariablePairFlag,
+  templateVariablesFiles []atc.PathFlag,
+) []VarSource {
+  sources := []VarSource{}
+  for _, path := range templateVariablesFiles {
+    sources = append(sources, YAMLFileVarSource{Path: string(path)})
+  }
+
+  if len(templateVariables) > 0 {
+    vars := map[string]interface{}{}
+    for _, f := range templateVariables {
+      vars[f.Name] = f.Value
+    }
+    sources = append(sources, StaticVarSource{Label: "-v flags", Vars: vars})
+  }
+
+  if len(yamlTemplateVariables) > 0 {
+    vars := map[string]interface{}{}
+    for _, f := range yamlTemplateVariables {
+      vars[f.Name] = f.Value
+    }
+    sources = append(sources, StaticVarSource{Label: "-y flags", Vars: vars})
+  }
+
+  return sources
+}
+
+type loadedVarSource struct {
+  name string
+  vars map[string]interface{}
+}
+
+func loadVarSources(sources []VarSource) ([]loadedVarSource, error) {
+  loaded := []loadedVarSource{}
+  for _, source := range sources {
+    vars, err := source.Variables()
+    if err != nil {
+      return nil, err
+    }
+
+    loaded = append(loaded, loadedVarSource{name: source.Name(), vars: vars})
+  }
+
+  return loaded, nil
+}
+
+func sortedVarNames(vars map[string]interface{}) []string {
+  names := make([]string, 0, len(vars))
+  for name := range vars {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+func sortedNames(set map[string]bool) []string {
+  names := make([]string, 0, len(set))
+  for name := range set {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// withoutVars returns sources minus the variables matching patterns.
+func withoutVars(sources []loadedVarSource, patterns []string) ([]loadedVarSource, error) {
+  filtered := make([]loadedVarSource, len(sources))
+  for i, source := range sources {
+    filtered[i] = loadedVarSource{name: source.name, vars: map[string]interface{}{}}
+    for name, value := range source.vars {
+      matched, err := matchesVarPattern(name, patterns)
+      if err != nil {
+        return nil, err
+      }
+      if !matched {
+        filtered[i].vars[name] = value
+      }
+    }
+  }
+  return filtered, nil
+}
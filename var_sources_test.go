@@ -0,0 +1,62 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "github.com/concourse/atc"
+  "github.com/stretchr/testify/assert"
+  yaml "gopkg.in/yaml.v2"
+)
+
+func writeTempFile(t *testing.T, dir, name, contents string) string {
+  path := filepath.Join(dir, name)
+  err := ioutil.WriteFile(path, []byte(contents), 0644)
+  assert.Nil(t, err)
+  return path
+}
+
+func TestVarSourcePrecedence(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "vars")
+  defer os.RemoveAll(dir)
+  varFile := writeTempFile(t, dir, "vars.yml", "jobName: fromFile\nimage: busybox\n")
+
+  configYaml, err := EvaluateConfigWithOptions([]byte(`jobs:
+  - name: ((jobName))
+    plan: [{task: ((image))}]`), EvaluateOptions{
+    Sources: []VarSource{
+      YAMLFileVarSource{Path: varFile},
+      StaticVarSource{Vars: map[string]interface{}{"jobName": "fromStatic"}},
+    },
+  })
+  assert.Nil(t, err)
+  var config atc.Config
+  _ = yaml.Unmarshal(configYaml, &config)
+  assert.Equal(t, "fromStatic", config.Jobs[0].Name, "Should let later sources win")
+  assert.Equal(t, "busybox", config.Jobs[0].Plan[0].Task, "Should fall back to earlier sources")
+}
+
+func TestEnvVarSource(t *testing.T) {
+  os.Setenv("TEST_VAR_jobName", "fromEnv")
+  defer os.Unsetenv("TEST_VAR_jobName")
+
+  vars, err := EnvVarSource{Prefix: "TEST_VAR_"}.Variables()
+  assert.Nil(t, err)
+  assert.Equal(t, map[string]interface{}{"jobName": "fromEnv"}, vars)
+
+  _, err = EnvVarSource{}.Variables()
+  assert.NotNil(t, err, "Should refuse to import the whole environment")
+}
+
+func TestDirVarSource(t *testing.T) {
+  dir, _ := ioutil.TempDir("", "vars")
+  defer os.RemoveAll(dir)
+  writeTempFile(t, dir, "password", "hunter2\n")
+  writeTempFile(t, dir, ".hidden", "ignored")
+  os.Mkdir(filepath.Join(dir, "nested"), 0755)
+
+  vars, err := DirVarSource{Path: dir}.Variables()
+  assert.Nil(t, err)
+  assert.Equal(t, map[string]interface{}{"password": "hunter2"}, vars)
+}